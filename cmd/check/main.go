@@ -6,6 +6,7 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/signal"
@@ -34,6 +35,9 @@ func onResult(filePath string, err error) {
 
 func main() {
 	filePath := flag.String("in", "", "file to be checked")
+	cfg := extsort.Config{}
+	extsort.BindOrderFlags(flag.CommandLine, &cfg)
+	extsort.BindRecordFormatFlags(flag.CommandLine, &cfg.RecordFormat)
 	flag.Parse()
 
 	if *filePath == "" {
@@ -47,13 +51,13 @@ func main() {
 	}
 
 	dur, err := misc.MeasureCallE(func() error {
-		return check(absFilePath)
+		return check(absFilePath, cfg)
 	})
 	log.Printf("duration: %v", dur)
 	onResult(absFilePath, err)
 }
 
-func check(filePath string) error {
+func check(filePath string, cfg extsort.Config) error {
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer stop()
 
@@ -66,14 +70,41 @@ func check(filePath string) error {
 
 	updateProgress := makeProgress(fileSize, log.Printf)
 	reader := bufio.NewReaderSize(file, extsort.DefaultWorkerReadBufSizeKb*1024)
-	linesGen := extsort.NewSyncLinesGenFromReader(ctx, reader)
+	framing := cfg.GetFraming()
+	recordReader := framing.NewReader(reader)
+
+	if cfg.RecordFormat.Header {
+		header, err := recordReader.ReadRecord()
+		if err == nil {
+			updateProgress(uint64(framing.SerializedSize(header)))
+		} else if !errors.Is(err, io.EOF) {
+			return err
+		}
+		cfg.Keys, err = extsort.ResolveKeyNames(cfg.Keys, cfg.HeaderColumns(header))
+		if err != nil {
+			return err
+		}
+	}
+
+	cmp := cfg.GetCompare()
+	checkRecord := cfg.GetRecordCheck()
 	prevLine := ""
-	linesCount, err := extsort.EnumLines(linesGen, func(line string) error {
-		if prevLine > line {
-			return extsort.ErrNotSorted
+	hasPrevLine := false
+	linesCount, err := extsort.EnumRecords(ctx, recordReader, func(line string) error {
+		if checkRecord != nil {
+			if err := checkRecord(line); err != nil {
+				return err
+			}
+		}
+		if hasPrevLine {
+			result := cmp(prevLine, line)
+			if result > 0 || (cfg.Unique && result == 0) {
+				return extsort.ErrNotSorted
+			}
 		}
 		prevLine = line
-		updateProgress(uint64(len(line)))
+		hasPrevLine = true
+		updateProgress(uint64(framing.SerializedSize(line)))
 		return nil
 	})
 
@@ -92,7 +123,7 @@ func makeProgress(max uint64, logf extsort.Logf) func(size uint64) {
 	return func(size uint64) {
 		guard.Lock()
 		defer guard.Unlock()
-		percents, value, changed := progress.Add(size + 1) // +1 is because of the line is without end of line = '\n'
+		percents, value, changed := progress.Add(size)
 		if changed {
 			logf(logMsgFmt, percents, value, fs.FormatFileSize(value))
 		}
@@ -25,6 +25,11 @@ const (
 	flagPreferredChunkSizeKb = "preferred_chunk_size_kb"
 	flagWorkerReadBufSizeKb  = "worker_read_buf_size_kb"
 	flagWorkerWriteBufSizeKb = "worker_write_buf_size_kb"
+	flagMerge                = "merge"
+	flagCheckSorted          = "check_sorted"
+	flagGzip                 = "gzip"
+	flagGzipLevel            = "gzip_level"
+	flagCompressTemp         = "compress_temp"
 )
 
 func ConfigFromFlags() (extsort.Config, error) {
@@ -33,17 +38,34 @@ func ConfigFromFlags() (extsort.Config, error) {
 		return cfg, err
 	}
 
-	flag.StringVar(&cfg.InputFilePath, flagInputFilePath, "", "input file path")
-	flag.StringVar(&cfg.OutputFilePath, flagOutputFilePath, "", "output file path")
+	var inputFilePaths []string
+	flag.Func(flagInputFilePath, "input file path or glob pattern, '-' is stdin (can be repeated)", func(pattern string) error {
+		matches, err := expandInputPattern(pattern)
+		inputFilePaths = append(inputFilePaths, matches...)
+		return err
+	})
+	flag.StringVar(&cfg.OutputFilePath, flagOutputFilePath, "", "output file path, '-' is stdout")
 	flag.StringVar(&cfg.TempDir, flagTempDir, extsort.GetDefaultTempDir(), "temp dir")
 	flag.IntVar(&cfg.WorkersCount, flagWorkersCount, extsort.GetDefaultWorkersCount(), "sort/merge workers count")
 	flag.IntVar(&cfg.ChunkCapacity, flagChunkCapacity, extsort.DefaultChunkCapacity, "initial chunk capacity")
 	preferredChunkSizeKb := flag.Int(flagPreferredChunkSizeKb, extsort.DefaultPreferredChunkSizeKb, "preferred size of chunk")
 	workerReadBufSizeKb := flag.Int(flagWorkerReadBufSizeKb, extsort.DefaultWorkerReadBufSizeKb, "worker's read buf size")
 	workerWriteBufSizeKb := flag.Int(flagWorkerWriteBufSizeKb, extsort.DefaultWorkerWriteBufSizeKb, "worker's write buf size")
+	flag.BoolVar(&cfg.MergeOnly, flagMerge, false, "merge already sorted inputs without sorting them")
+	flag.BoolVar(&cfg.CheckSorted, flagCheckSorted, false, "fail the merge if an input is not sorted")
+	flag.BoolVar(&cfg.GzipOutput, flagGzip, false, "gzip the output (gzipped inputs are always detected)")
+	flag.BoolVar(&cfg.CompressTempFiles, flagCompressTemp, false, "compress temp files, it saves temp space and I/O for CPU time")
+	flag.IntVar(&cfg.GzipLevel, flagGzipLevel, cfg.GzipLevel, "gzip level of the output: 1 (best speed) - 9 (best compression), -1 is the default")
+	extsort.BindOrderFlags(flag.CommandLine, &cfg)
+	extsort.BindRecordFormatFlags(flag.CommandLine, &cfg.RecordFormat)
 
 	flag.Parse()
 
+	cfg.InputFilePath, cfg.InputFilePaths = "", nil
+	if len(inputFilePaths) > 0 {
+		cfg.InputFilePath, cfg.InputFilePaths = inputFilePaths[0], inputFilePaths[1:]
+	}
+
 	cfg.PreferredChunkSize = *preferredChunkSizeKb * 1024
 	cfg.WorkerReadBufSize = *workerReadBufSizeKb * 1024
 	cfg.WorkerWriteBufSize = *workerWriteBufSizeKb * 1024
@@ -56,7 +78,8 @@ func ConfigFromFlags() (extsort.Config, error) {
 }
 
 func main() {
-	l := log.Default()
+	l := log.New(os.Stderr, "", log.LstdFlags) // stdout may be the output
+	flag.CommandLine.SetOutput(os.Stderr)
 	err := execMain(l)
 	if err != nil {
 		l.Fatal(err)
@@ -129,12 +152,19 @@ func preparePaths(cfg extsort.Config) (extsort.Config, func() error, error) {
 
 func makePathsAbs(cfg extsort.Config) (extsort.Config, error) {
 	var err error
-	cfg.InputFilePath, err = filepath.Abs(cfg.InputFilePath)
+	cfg.InputFilePath, err = makePathAbs(cfg.InputFilePath)
 	if err != nil {
 		return cfg, err
 	}
 
-	cfg.OutputFilePath, err = filepath.Abs(cfg.OutputFilePath)
+	for i := range cfg.InputFilePaths {
+		cfg.InputFilePaths[i], err = makePathAbs(cfg.InputFilePaths[i])
+		if err != nil {
+			return cfg, err
+		}
+	}
+
+	cfg.OutputFilePath, err = makePathAbs(cfg.OutputFilePath)
 	if err != nil {
 		return cfg, err
 	}
@@ -146,3 +176,29 @@ func makePathsAbs(cfg extsort.Config) (extsort.Config, error) {
 
 	return cfg, nil
 }
+
+func makePathAbs(path string) (string, error) {
+	if path == extsort.StdioFilePath {
+		return path, nil
+	}
+	return filepath.Abs(path)
+}
+
+// expandInputPattern returns files matching the glob pattern in the lexical order,
+// a pattern without matches is returned as is to be reported as a missing file.
+func expandInputPattern(pattern string) ([]string, error) {
+	if pattern == extsort.StdioFilePath {
+		return []string{pattern}, nil
+	}
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(matches) == 0 {
+		return []string{pattern}, nil
+	}
+
+	return matches, nil
+}
@@ -0,0 +1,170 @@
+package extsort
+
+import (
+	"fmt"
+	"math"
+)
+
+// BinaryKey selects the key of fixed size binary records. Zero Length of the BinaryKeyBytes
+// key means the end of the record, other types have their own sizes.
+type BinaryKey struct {
+	Offset int
+	Length int
+	Type   BinaryKeyType
+}
+
+func (this BinaryKey) IsEmpty() bool {
+	return this == BinaryKey{}
+}
+
+func (this BinaryKey) Check(recordSize int) error {
+	if err := this.Type.Check(); err != nil {
+		return err
+	}
+
+	if this.Offset < 0 || this.Length < 0 {
+		return fmt.Errorf("%w: binary key offset or length is negative", ErrBadConfig)
+	}
+
+	if this.Type != BinaryKeyBytes && this.Length != 0 && this.Length != binaryKeyTypes[this.Type].size {
+		return fmt.Errorf("%w: binary key length does not match %v", ErrBadConfig, this.Type)
+	}
+
+	if this.Offset+this.size(recordSize) > recordSize {
+		return fmt.Errorf("%w: binary key is out of %v bytes record", ErrBadConfig, recordSize)
+	}
+
+	return nil
+}
+
+func (this BinaryKey) MakeCompare(recordSize int) Compare {
+	begin := this.Offset
+	end := begin + this.size(recordSize)
+	cmp := binaryKeyTypes[this.Type].compare
+	return func(lhs, rhs string) int {
+		return cmp(lhs[begin:end], rhs[begin:end])
+	}
+}
+
+func (this BinaryKey) size(recordSize int) int {
+	if this.Type != BinaryKeyBytes {
+		return binaryKeyTypes[this.Type].size
+	}
+	if this.Length == 0 {
+		return recordSize - this.Offset
+	}
+	return this.Length
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+type BinaryKeyType int
+
+const (
+	BinaryKeyBytes BinaryKeyType = iota
+	BinaryKeyUint32LE
+	BinaryKeyUint32BE
+	BinaryKeyUint64LE
+	BinaryKeyUint64BE
+	BinaryKeyInt64LE
+	BinaryKeyInt64BE
+	BinaryKeyFloat64LE
+	BinaryKeyFloat64BE
+)
+
+var binaryKeyTypes = []struct {
+	name    string
+	size    int
+	compare Compare
+}{
+	BinaryKeyBytes:     {"bytes", 0, BytesCompare},
+	BinaryKeyUint32LE:  {"uint32_le", 4, makeUintCompare(false)},
+	BinaryKeyUint32BE:  {"uint32_be", 4, makeUintCompare(true)},
+	BinaryKeyUint64LE:  {"uint64_le", 8, makeUintCompare(false)},
+	BinaryKeyUint64BE:  {"uint64_be", 8, makeUintCompare(true)},
+	BinaryKeyInt64LE:   {"int64_le", 8, makeInt64Compare(false)},
+	BinaryKeyInt64BE:   {"int64_be", 8, makeInt64Compare(true)},
+	BinaryKeyFloat64LE: {"float64_le", 8, makeFloat64Compare(false)},
+	BinaryKeyFloat64BE: {"float64_be", 8, makeFloat64Compare(true)},
+}
+
+func ParseBinaryKeyType(name string) (BinaryKeyType, error) {
+	for keyType, t := range binaryKeyTypes {
+		if t.name == name {
+			return BinaryKeyType(keyType), nil
+		}
+	}
+	return BinaryKeyBytes, fmt.Errorf("%w: unknown binary key type '%v'", ErrBadConfig, name)
+}
+
+func (this BinaryKeyType) Check() error {
+	if this < 0 || int(this) >= len(binaryKeyTypes) {
+		return fmt.Errorf("%w: unknown binary key type %d", ErrBadConfig, int(this))
+	}
+	return nil
+}
+
+func (this BinaryKeyType) String() string {
+	if this.Check() != nil {
+		return fmt.Sprintf("BinaryKeyType(%d)", int(this))
+	}
+	return binaryKeyTypes[this].name
+}
+
+func BinaryKeyTypeNames() []string {
+	names := make([]string, 0, len(binaryKeyTypes))
+	for _, t := range binaryKeyTypes {
+		names = append(names, t.name)
+	}
+	return names
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+func makeUintCompare(bigEndian bool) Compare {
+	return func(lhs, rhs string) int {
+		return compareOrdered(decodeUint(lhs, bigEndian), decodeUint(rhs, bigEndian))
+	}
+}
+
+func makeInt64Compare(bigEndian bool) Compare {
+	return func(lhs, rhs string) int {
+		return compareOrdered(int64(decodeUint(lhs, bigEndian)), int64(decodeUint(rhs, bigEndian)))
+	}
+}
+
+// makeFloat64Compare orders NaNs before all numbers like GeneralNumericCompare does.
+func makeFloat64Compare(bigEndian bool) Compare {
+	return func(lhs, rhs string) int {
+		lhsVal := math.Float64frombits(decodeUint(lhs, bigEndian))
+		rhsVal := math.Float64frombits(decodeUint(rhs, bigEndian))
+		lhsNan := math.IsNaN(lhsVal)
+		rhsNan := math.IsNaN(rhsVal)
+		if lhsNan || rhsNan {
+			return compareBools(!lhsNan, !rhsNan)
+		}
+		return compareOrdered(lhsVal, rhsVal)
+	}
+}
+
+func decodeUint(data string, bigEndian bool) uint64 {
+	result := uint64(0)
+	for i := 0; i < len(data); i++ {
+		if bigEndian {
+			result = result<<8 | uint64(data[i])
+		} else {
+			result |= uint64(data[i]) << (8 * i)
+		}
+	}
+	return result
+}
+
+func compareOrdered[T int64 | uint64 | float64](lhs, rhs T) int {
+	if lhs < rhs {
+		return -1
+	}
+	if lhs > rhs {
+		return 1
+	}
+	return 0
+}
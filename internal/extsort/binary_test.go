@@ -0,0 +1,39 @@
+package extsort
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/kdpdev/extsort/internal/utils/tests"
+)
+
+func Test_BinaryKey_Compare(t *testing.T) {
+	le64 := func(val uint64) string { return string(binary.LittleEndian.AppendUint64(nil, val)) }
+	be64 := func(val uint64) string { return string(binary.BigEndian.AppendUint64(nil, val)) }
+	le32 := func(val uint32) string { return string(binary.LittleEndian.AppendUint32(nil, val)) }
+	f64 := func(val float64) string { return le64(math.Float64bits(val)) }
+
+	checkCompareOrder(t, BinaryKey{Type: BinaryKeyUint64LE}.MakeCompare(8),
+		[]string{le64(0)}, []string{le64(255)}, []string{le64(256)}, []string{le64(math.MaxUint64)})
+	checkCompareOrder(t, BinaryKey{Type: BinaryKeyUint64BE}.MakeCompare(8),
+		[]string{be64(1)}, []string{be64(1 << 40)}, []string{be64(math.MaxUint64)})
+	checkCompareOrder(t, BinaryKey{Type: BinaryKeyInt64LE}.MakeCompare(8),
+		[]string{le64(uint64(1) << 63)}, []string{le64(math.MaxUint64)}, []string{le64(0)}, []string{le64(1)})
+	checkCompareOrder(t, BinaryKey{Offset: 2, Type: BinaryKeyUint32LE}.MakeCompare(6),
+		[]string{"zz" + le32(1), "aa" + le32(1)}, []string{"aa" + le32(1<<16)})
+	checkCompareOrder(t, BinaryKey{Type: BinaryKeyFloat64LE}.MakeCompare(8),
+		[]string{f64(math.NaN())}, []string{f64(math.Inf(-1))}, []string{f64(-1.5)}, []string{f64(0), f64(math.Copysign(0, -1))}, []string{f64(2)})
+	checkCompareOrder(t, BinaryKey{Offset: 1, Length: 2}.MakeCompare(4),
+		[]string{"zaaz", "aaaa"}, []string{"aabz"}, []string{"abaa"})
+
+	tests.CheckNotError(t, BinaryKey{Offset: 92, Type: BinaryKeyUint64LE}.Check(100))
+	tests.CheckNotError(t, BinaryKey{Offset: 0, Length: 10}.Check(100))
+	tests.CheckErrorIs(t, ErrBadConfig, BinaryKey{Offset: 93, Type: BinaryKeyUint64LE}.Check(100))
+	tests.CheckErrorIs(t, ErrBadConfig, BinaryKey{Offset: 95, Length: 10}.Check(100))
+	tests.CheckErrorIs(t, ErrBadConfig, BinaryKey{Length: 4, Type: BinaryKeyUint64LE}.Check(100))
+	tests.CheckErrorIs(t, ErrBadConfig, BinaryKey{Offset: -1}.Check(100))
+	tests.CheckErrorIs(t, ErrBadConfig, BinaryKey{Type: -1}.Check(100))
+
+	tests.CheckErrorIs(t, ErrBadConfig, Config{InputFilePath: "in", OutputFilePath: "out", TempDir: "temp", ChunkCapacity: 1, WorkersCount: 1, BinaryKey: BinaryKey{Offset: 1}}.Check())
+}
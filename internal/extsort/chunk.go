@@ -11,7 +11,10 @@ type StringsChunk interface {
 	Add(s string)
 	SerializedDataSize() int
 	Len() int
-	Sort()
+	Sort(cmp Compare)
+	StableSort(cmp Compare)
+	SortByKey(key RecordKey, stable bool)
+	Unique(cmp Compare) int
 	Write(w io.Writer) (int, error)
 }
 
@@ -20,12 +23,18 @@ type StringsChunk interface {
 type ArrStringsChunk struct {
 	storage  []string
 	dataSize int
+	framing  RecordFraming
 }
 
 func NewArrStringsChunk(capacity int) *ArrStringsChunk {
+	return NewArrStringsChunkWithFraming(capacity, nil)
+}
+
+func NewArrStringsChunkWithFraming(capacity int, framing RecordFraming) *ArrStringsChunk {
 	storage := make([]string, 0, alg.Max(capacity, 0))
 	return &ArrStringsChunk{
 		storage: storage,
+		framing: FramingOrDefault(framing),
 	}
 }
 
@@ -35,45 +44,93 @@ func (this *ArrStringsChunk) Get(idx int) string {
 
 func (this *ArrStringsChunk) Add(s string) {
 	this.storage = append(this.storage, s)
-	this.dataSize += len(s)
+	this.dataSize += this.framing.SerializedSize(s)
 }
 
 func (this *ArrStringsChunk) SerializedDataSize() int {
-	return this.dataSize + len(this.storage)
+	return this.dataSize
 }
 
 func (this *ArrStringsChunk) Len() int {
 	return len(this.storage)
 }
 
-func (this *ArrStringsChunk) Sort() {
-	sort.Strings(this.storage)
+func (this *ArrStringsChunk) Sort(cmp Compare) {
+	less := MakeLess(cmp)
+	sort.Slice(this.storage, func(i, j int) bool {
+		return less(this.storage[i], this.storage[j])
+	})
 }
 
-func (this *ArrStringsChunk) IsSorted() bool {
-	return sort.SliceIsSorted(*this, func(i, j int) bool {
-		return this.storage[i] < this.storage[j]
+func (this *ArrStringsChunk) StableSort(cmp Compare) {
+	less := MakeLess(cmp)
+	sort.SliceStable(this.storage, func(i, j int) bool {
+		return less(this.storage[i], this.storage[j])
+	})
+}
+
+// SortByKey sorts records by their keys which are extracted once per record.
+func (this *ArrStringsChunk) SortByKey(key RecordKey, stable bool) {
+	records := make([]keyedRecord, len(this.storage))
+	for i, record := range this.storage {
+		records[i] = keyedRecord{record: record, key: key.Extract(record)}
+	}
+
+	less := func(i, j int) bool {
+		return key.Compare(records[i].key, records[j].key) < 0
+	}
+	if stable {
+		sort.SliceStable(records, less)
+	} else {
+		sort.Slice(records, less)
+	}
+
+	for i := range records {
+		this.storage[i] = records[i].record
+	}
+}
+
+func (this *ArrStringsChunk) Unique(cmp Compare) int {
+	if len(this.storage) < 2 {
+		return 0
+	}
+
+	cmp = CompareOrDefault(cmp)
+	last := 0
+	for i := 1; i < len(this.storage); i++ {
+		if cmp(this.storage[last], this.storage[i]) == 0 {
+			this.dataSize -= this.framing.SerializedSize(this.storage[i])
+			continue
+		}
+		last++
+		this.storage[last] = this.storage[i]
+	}
+
+	removed := len(this.storage) - last - 1
+	for i := last + 1; i < len(this.storage); i++ {
+		this.storage[i] = ""
+	}
+	this.storage = this.storage[:last+1]
+
+	return removed
+}
+
+func (this *ArrStringsChunk) IsSorted(cmp Compare) bool {
+	less := MakeLess(cmp)
+	return sort.SliceIsSorted(this.storage, func(i, j int) bool {
+		return less(this.storage[i], this.storage[j])
 	})
 }
 
 func (this *ArrStringsChunk) Write(w io.Writer) (int, error) {
-	endOfLine := []byte{'\n'}
 	written := 0
+	writer := this.framing.NewWriter(w)
 	for _, line := range this.storage {
-		n, err := io.WriteString(w, line)
+		n, err := writer.WriteRecord(line)
 		written += n
-		if err == nil {
-			n2, err2 := w.Write(endOfLine)
-			written += n2
-			n += n2
-			err = err2
-		}
 		if err != nil {
 			return written, err
 		}
-		if n != len(line)+1 {
-			return written, ErrUnexpectedWrittenBytesCount
-		}
 	}
 
 	return written, nil
@@ -20,7 +20,7 @@ func Test_Chunk(t *testing.T) {
 	tests.CheckExpected(t, len(lines), chunk.Len())
 	tests.CheckExpected(t, linesDataSize+len(lines), chunk.SerializedDataSize())
 
-	chunk.Sort()
+	chunk.Sort(nil)
 
 	buf := bytes.NewBuffer(nil)
 	n, err := chunk.Write(buf)
@@ -32,3 +32,53 @@ func Test_Chunk(t *testing.T) {
 
 	tests.CheckExpected(t, sortedLines, buf.String())
 }
+
+func Test_Chunk_Compare(t *testing.T) {
+	lines := []string{"b", "c", "a"}
+	chunk := NewArrStringsChunk(0)
+	for _, l := range lines {
+		chunk.Add(l)
+	}
+
+	descending := ReverseCompare(nil)
+
+	chunk.Sort(descending)
+	tests.CheckExpected(t, true, chunk.IsSorted(descending))
+	tests.CheckExpected(t, false, chunk.IsSorted(nil))
+
+	buf := bytes.NewBuffer(nil)
+	_, err := chunk.Write(buf)
+	tests.CheckNotError(t, err)
+	tests.CheckExpected(t, "c\nb\na\n", buf.String())
+}
+
+func Test_Chunk_Unique(t *testing.T) {
+	chunk := NewArrStringsChunk(0)
+	for _, l := range []string{"b", "a", "b", "c", "a", "b"} {
+		chunk.Add(l)
+	}
+
+	chunk.Sort(nil)
+	tests.CheckExpected(t, 3, chunk.Unique(nil))
+	tests.CheckExpected(t, 3, chunk.Len())
+	tests.CheckExpected(t, 6, chunk.SerializedDataSize())
+
+	buf := bytes.NewBuffer(nil)
+	_, err := chunk.Write(buf)
+	tests.CheckNotError(t, err)
+	tests.CheckExpected(t, "a\nb\nc\n", buf.String())
+}
+
+func Test_Chunk_Version(t *testing.T) {
+	chunk := NewArrStringsChunk(0)
+	for _, l := range []string{"file10", "file2", "file1"} {
+		chunk.Add(l)
+	}
+
+	chunk.Sort(VersionCompare)
+
+	buf := bytes.NewBuffer(nil)
+	_, err := chunk.Write(buf)
+	tests.CheckNotError(t, err)
+	tests.CheckExpected(t, "file1\nfile2\nfile10\n", buf.String())
+}
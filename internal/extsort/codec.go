@@ -0,0 +1,80 @@
+package extsort
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"strings"
+)
+
+// Codec converts values to records and back. The framing must be able to hold any encoded value.
+type Codec[T any] interface {
+	Framing() RecordFraming
+	Encode(value T) (string, error)
+	Decode(record string) (T, error)
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// GobCodec encodes every value as a standalone gob stream, so records carry the type description
+// and can be decoded in any order. Records are framed by varint length prefixes.
+type GobCodec[T any] struct{}
+
+func NewGobCodec[T any]() GobCodec[T] {
+	return GobCodec[T]{}
+}
+
+func (this GobCodec[T]) Framing() RecordFraming {
+	return RecordFormat{LengthPrefix: LengthPrefixVarint}.Framing()
+}
+
+func (this GobCodec[T]) Encode(value T) (string, error) {
+	buf := &bytes.Buffer{}
+	if err := gob.NewEncoder(buf).Encode(value); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func (this GobCodec[T]) Decode(record string) (T, error) {
+	var value T
+	err := gob.NewDecoder(strings.NewReader(record)).Decode(&value)
+	return value, err
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// BinaryCodec encodes fixed-size values by encoding/binary, records have no framing overhead.
+type BinaryCodec[T any] struct {
+	order binary.ByteOrder
+	size  int
+}
+
+func NewBinaryCodec[T any](order binary.ByteOrder) (BinaryCodec[T], error) {
+	var value T
+	size := binary.Size(value)
+	if size <= 0 {
+		return BinaryCodec[T]{}, fmt.Errorf("%w: %T is not a fixed-size value", ErrBadConfig, value)
+	}
+	return BinaryCodec[T]{order: order, size: size}, nil
+}
+
+func (this BinaryCodec[T]) Framing() RecordFraming {
+	return RecordFormat{FixedSize: this.size}.Framing()
+}
+
+func (this BinaryCodec[T]) Encode(value T) (string, error) {
+	buf := &bytes.Buffer{}
+	buf.Grow(this.size)
+	if err := binary.Write(buf, this.order, value); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func (this BinaryCodec[T]) Decode(record string) (T, error) {
+	var value T
+	err := binary.Read(strings.NewReader(record), this.order, &value)
+	return value, err
+}
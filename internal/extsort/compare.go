@@ -0,0 +1,154 @@
+package extsort
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Compare func(lhs, rhs string) int
+
+type CompareMode int
+
+const (
+	CompareModeBytes CompareMode = iota
+	CompareModeNumeric
+	CompareModeGeneralNumeric
+	CompareModeHumanNumeric
+	CompareModeVersion
+)
+
+var compareModes = []struct {
+	name    string
+	letter  rune
+	compare Compare
+}{
+	CompareModeBytes:          {"bytes", 0, BytesCompare},
+	CompareModeNumeric:        {"numeric", 'n', NumericCompare},
+	CompareModeGeneralNumeric: {"general_numeric", 'g', GeneralNumericCompare},
+	CompareModeHumanNumeric:   {"human_numeric", 'h', HumanNumericCompare},
+	CompareModeVersion:        {"version", 'V', VersionCompare},
+}
+
+func ParseCompareMode(name string) (CompareMode, error) {
+	for mode, m := range compareModes {
+		if m.name == name {
+			return CompareMode(mode), nil
+		}
+	}
+	return CompareModeBytes, fmt.Errorf("%w: unknown compare mode '%v'", ErrBadConfig, name)
+}
+
+func (this CompareMode) Check() error {
+	if this < 0 || int(this) >= len(compareModes) {
+		return fmt.Errorf("%w: unknown compare mode %d", ErrBadConfig, int(this))
+	}
+	return nil
+}
+
+func (this CompareMode) String() string {
+	if this.Check() != nil {
+		return fmt.Sprintf("CompareMode(%d)", int(this))
+	}
+	return compareModes[this].name
+}
+
+func (this CompareMode) Compare() Compare {
+	if this.Check() != nil {
+		return BytesCompare
+	}
+	return compareModes[this].compare
+}
+
+func CompareModeNames() []string {
+	names := make([]string, 0, len(compareModes))
+	for _, m := range compareModes {
+		names = append(names, m.name)
+	}
+	return names
+}
+
+func BytesCompare(lhs, rhs string) int {
+	return strings.Compare(lhs, rhs)
+}
+
+func CompareOrDefault(cmp Compare) Compare {
+	if cmp == nil {
+		return BytesCompare
+	}
+	return cmp
+}
+
+func ReverseCompare(cmp Compare) Compare {
+	cmp = CompareOrDefault(cmp)
+	return func(lhs, rhs string) int {
+		return cmp(rhs, lhs)
+	}
+}
+
+func ChainCompare(cmp Compare, next Compare) Compare {
+	cmp = CompareOrDefault(cmp)
+	next = CompareOrDefault(next)
+	return func(lhs, rhs string) int {
+		if result := cmp(lhs, rhs); result != 0 {
+			return result
+		}
+		return next(lhs, rhs)
+	}
+}
+
+func MakeLess(cmp Compare) func(lhs, rhs string) bool {
+	cmp = CompareOrDefault(cmp)
+	return func(lhs, rhs string) bool {
+		return cmp(lhs, rhs) < 0
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// RecordKey extracts the key of the record once, so records held by chunks and merges are compared
+// by their keys instead of extracting the key on every comparison, e.g. parsing JSON.
+type RecordKey struct {
+	Extract func(record string) any
+	Compare func(lhs, rhs any) int // compares the extracted keys
+}
+
+func (this RecordKey) IsEmpty() bool {
+	return this.Extract == nil
+}
+
+// MakeCompare makes the compare of records which extracts their keys on every comparison.
+func (this RecordKey) MakeCompare() Compare {
+	return func(lhs, rhs string) int {
+		return this.Compare(this.Extract(lhs), this.Extract(rhs))
+	}
+}
+
+type keyedRecord struct {
+	record string
+	key    any
+}
+
+// keyedCompare compares records by their extracted keys if the key is not empty and by cmp otherwise.
+type keyedCompare struct {
+	key RecordKey
+	cmp Compare
+}
+
+func makeKeyedCompare(key RecordKey, cmp Compare) keyedCompare {
+	return keyedCompare{key: key, cmp: CompareOrDefault(cmp)}
+}
+
+// extract returns the key of the record or nil if the key is empty.
+func (this keyedCompare) extract(record string) any {
+	if this.key.IsEmpty() {
+		return nil
+	}
+	return this.key.Extract(record)
+}
+
+func (this keyedCompare) compare(lhs string, lhsKey any, rhs string, rhsKey any) int {
+	if this.key.IsEmpty() {
+		return this.cmp(lhs, rhs)
+	}
+	return this.key.Compare(lhsKey, rhsKey)
+}
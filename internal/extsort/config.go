@@ -1,9 +1,11 @@
 package extsort
 
 import (
+	"compress/gzip"
 	"fmt"
 	"path/filepath"
 	"runtime"
+	"strings"
 )
 
 const (
@@ -11,8 +13,11 @@ const (
 	DefaultPreferredChunkSizeKb = 128
 	DefaultWorkerReadBufSizeKb  = 32
 	DefaultWorkerWriteBufSizeKb = 32
+	DefaultMaxOpenFiles         = 256
 
 	DefaultTempDir = "temp"
+
+	StdioFilePath = "-" // stdin as the input, stdout as the output
 )
 
 func GetDefaultTempDir() string {
@@ -34,12 +39,14 @@ func NewDefaultConfig() (Config, error) {
 	cfg.PreferredChunkSize = DefaultPreferredChunkSizeKb * 1024
 	cfg.WorkerReadBufSize = DefaultWorkerReadBufSizeKb * 1024
 	cfg.WorkerWriteBufSize = DefaultWorkerWriteBufSizeKb * 1024
+	cfg.GzipLevel = gzip.DefaultCompression
 
 	return cfg, cfg.Check()
 }
 
 type Config struct {
 	InputFilePath      string
+	InputFilePaths     []string // sorted together with the InputFilePath, e.g. shards of the input
 	OutputFilePath     string
 	TempDir            string
 	WorkersCount       int
@@ -47,10 +54,27 @@ type Config struct {
 	PreferredChunkSize int
 	WorkerReadBufSize  int
 	WorkerWriteBufSize int
+	Compare            Compare
+	CompareMode        CompareMode
+	FieldSeparator     string
+	Keys               []Key
+	JSONKey            JSONKey
+	BinaryKey          BinaryKey
+	ExtractKey         func(record string) string // the key of opaque records, e.g. length-prefixed blobs
+	Reverse            bool
+	Unique             bool
+	Stable             bool
+	MergeOnly          bool // the inputs are already sorted, they are merged without the sorting
+	CheckSorted        bool // the MergeOnly fails with ErrNotSorted on the first record out of order
+	GzipOutput         bool // gzipped inputs are detected, the output is gzipped only if it is set
+	GzipLevel          int  // compress/gzip level of the output
+	CompressTempFiles  bool // chunks and merged files take less space in the TempDir for the CPU time
+	RecordFormat       RecordFormat
 }
 
 func (this Config) Check() error {
-	if this.InputFilePath == "" {
+	inputFilePaths := this.GetInputFilePaths()
+	if len(inputFilePaths) == 0 {
 		return fmt.Errorf("%w: InputFilePath is not specified", ErrBadConfig)
 	}
 
@@ -58,18 +82,48 @@ func (this Config) Check() error {
 		return fmt.Errorf("%w: OutputFilePath is not specified", ErrBadConfig)
 	}
 
-	if this.InputFilePath == this.OutputFilePath {
-		return fmt.Errorf("%w: InputFilePath and OutputFilePath are the same", ErrBadConfig)
+	stdinCount := 0
+	for _, inputFilePath := range inputFilePaths {
+		if inputFilePath == "" {
+			return fmt.Errorf("%w: one of InputFilePaths is empty", ErrBadConfig)
+		}
+
+		if inputFilePath == StdioFilePath {
+			stdinCount++
+			continue
+		}
+
+		if inputFilePath == this.OutputFilePath {
+			return fmt.Errorf("%w: InputFilePath and OutputFilePath are the same", ErrBadConfig)
+		}
 	}
 
-	if this.TempDir == "" {
-		return fmt.Errorf("%w: TempDir is not specified", ErrBadConfig)
+	if stdinCount > 1 {
+		return fmt.Errorf("%w: stdin is specified as the input more than once", ErrBadConfig)
 	}
 
-	if filepath.Dir(this.OutputFilePath) == this.TempDir {
+	if this.OutputFilePath != StdioFilePath && filepath.Dir(this.OutputFilePath) == this.TempDir {
 		return fmt.Errorf("%w, OutputFilePath file is in the TempDir", ErrBadConfig)
 	}
 
+	return this.CheckSorting()
+}
+
+// GetInputFilePaths returns the InputFilePath (if it is set) followed by the InputFilePaths.
+func (this Config) GetInputFilePaths() []string {
+	result := make([]string, 0, len(this.InputFilePaths)+1)
+	if this.InputFilePath != "" {
+		result = append(result, this.InputFilePath)
+	}
+	return append(result, this.InputFilePaths...)
+}
+
+// CheckSorting checks everything except the input and output files, e.g. for SortStream.
+func (this Config) CheckSorting() error {
+	if this.TempDir == "" {
+		return fmt.Errorf("%w: TempDir is not specified", ErrBadConfig)
+	}
+
 	if this.ChunkCapacity <= 0 {
 		return fmt.Errorf("%w: ChunkCapacity is negative", ErrBadConfig)
 	}
@@ -90,5 +144,162 @@ func (this Config) Check() error {
 		return fmt.Errorf("%w: WorkersCount is negative or zero", ErrBadConfig)
 	}
 
+	if this.GzipOutput && (this.GzipLevel < gzip.HuffmanOnly || this.GzipLevel > gzip.BestCompression) {
+		return fmt.Errorf("%w: GzipLevel is out of range", ErrBadConfig)
+	}
+
+	if this.CheckSorted && !this.MergeOnly {
+		return fmt.Errorf("%w: CheckSorted requires MergeOnly", ErrBadConfig)
+	}
+
+	if err := this.RecordFormat.Check(); err != nil {
+		return err
+	}
+
+	if err := this.CompareMode.Check(); err != nil {
+		return err
+	}
+
+	if !this.JSONKey.IsEmpty() {
+		if err := this.JSONKey.Check(); err != nil {
+			return err
+		}
+		if len(this.Keys) > 0 || this.RecordFormat.CSV {
+			return fmt.Errorf("%w: JSONKey is incompatible with Keys and CSV", ErrBadConfig)
+		}
+	}
+
+	if this.RecordFormat.FixedSize > 0 {
+		if err := this.BinaryKey.Check(this.RecordFormat.FixedSize); err != nil {
+			return err
+		}
+		if len(this.Keys) > 0 || !this.JSONKey.IsEmpty() || this.CompareMode != CompareModeBytes {
+			return fmt.Errorf("%w: FixedSize records are compared by BinaryKey only", ErrBadConfig)
+		}
+	} else if !this.BinaryKey.IsEmpty() {
+		return fmt.Errorf("%w: BinaryKey requires FixedSize records", ErrBadConfig)
+	}
+
+	if this.ExtractKey != nil && (len(this.Keys) > 0 || !this.JSONKey.IsEmpty() || !this.BinaryKey.IsEmpty() || this.RecordFormat.CSV) {
+		return fmt.Errorf("%w: ExtractKey is incompatible with other keys and CSV", ErrBadConfig)
+	}
+
+	if this.RecordFormat.CSV && len(this.FieldSeparator) > 1 {
+		return fmt.Errorf("%w: CSV FieldSeparator must be a single byte", ErrBadConfig)
+	}
+
+	for _, key := range this.Keys {
+		if err := key.Check(); err != nil {
+			return err
+		}
+		if key.HasNames() && !this.RecordFormat.Header {
+			return fmt.Errorf("%w: key '%v' refers to columns without header", ErrBadConfig, key)
+		}
+	}
+
 	return nil
 }
+
+// HeaderColumns splits the header record into column names the same way as keys split records into fields.
+func (this Config) HeaderColumns(header string) []string {
+	if this.RecordFormat.CSV {
+		return SplitCSVRecord(header, this.csvComma())
+	}
+	if this.FieldSeparator != "" {
+		return strings.Split(header, this.FieldSeparator)
+	}
+	return strings.Fields(header)
+}
+
+// GetCompare makes the compare of lines. Like in 'sort', CompareMode and Reverse are applied
+// to the whole line if there are no keys, and to the keys which have no own options.
+// Lines with equal keys are compared as bytes unless the sort is stable or unique, so like in 'sort -u'
+// the unique sort keeps only the first of lines with equal keys.
+// CSV records without keys are compared by all the unquoted fields.
+// Keys referring to columns by names must be resolved by ResolveKeyNames.
+// The JSONKey and the BinaryKey of FixedSize records replace keys and CompareMode.
+// The CompareMode and Reverse are applied to keys returned by ExtractKey.
+func (this Config) GetCompare() Compare {
+	defaultKeyOptions := KeyOptions{Mode: this.CompareMode, Reverse: this.Reverse}
+
+	keys := this.Keys
+	if len(keys) == 0 && this.RecordFormat.CSV {
+		keys = []Key{{StartField: 1}}
+	}
+
+	hasJSONKey := !this.JSONKey.IsEmpty()
+	hasBinaryKey := this.RecordFormat.FixedSize > 0 && !this.BinaryKey.IsEmpty()
+
+	var cmp Compare
+	if hasJSONKey {
+		cmp = this.JSONKey.MakeCompare(this.Reverse)
+	} else if hasBinaryKey {
+		cmp = this.BinaryKey.MakeCompare(this.RecordFormat.FixedSize)
+		if this.Reverse {
+			cmp = ReverseCompare(cmp)
+		}
+	} else if this.ExtractKey != nil {
+		cmp = MakeExtractedKeyCompare(this.ExtractKey, defaultKeyOptions.MakeCompare(this.Compare))
+	} else if len(keys) == 0 {
+		cmp = defaultKeyOptions.MakeCompare(this.Compare)
+	} else {
+		keys = append([]Key(nil), keys...)
+		for i := range keys {
+			if keys[i].KeyOptions.IsEmpty() {
+				keys[i].KeyOptions = defaultKeyOptions
+			}
+		}
+		if this.RecordFormat.CSV {
+			cmp = MakeCSVKeysCompare(keys, this.csvComma(), this.Compare)
+		} else {
+			cmp = MakeKeysCompare(keys, this.FieldSeparator, this.Compare)
+		}
+	}
+
+	if (len(keys) > 0 || hasJSONKey || hasBinaryKey || this.ExtractKey != nil || this.CompareMode != CompareModeBytes) && !this.Stable && !this.Unique {
+		cmp = ChainCompare(cmp, this.lastResortCompare())
+	}
+
+	return cmp
+}
+
+// GetRecordKey returns the key which is extracted once per record and orders records like GetCompare,
+// it is empty unless records are compared by the JSONKey.
+func (this Config) GetRecordKey() RecordKey {
+	if this.JSONKey.IsEmpty() {
+		return RecordKey{}
+	}
+
+	var tie Compare
+	if !this.Stable && !this.Unique {
+		tie = this.lastResortCompare()
+	}
+	return this.JSONKey.MakeRecordKey(this.Reverse, tie)
+}
+
+func (this Config) lastResortCompare() Compare {
+	if this.Reverse {
+		return ReverseCompare(BytesCompare)
+	}
+	return BytesCompare
+}
+
+// GetRecordCheck returns the check of input records or nil if records are not checked.
+func (this Config) GetRecordCheck() func(record string) error {
+	if this.JSONKey.IsEmpty() || this.JSONKey.Missing != JSONMissingError {
+		return nil
+	}
+	return this.JSONKey.CheckRecord
+}
+
+// GetFraming returns the framing of records, CSV fields are separated by FieldSeparator.
+func (this Config) GetFraming() RecordFraming {
+	return this.RecordFormat.framing(this.csvComma())
+}
+
+func (this Config) csvComma() byte {
+	if this.FieldSeparator == "" {
+		return ','
+	}
+	return this.FieldSeparator[0]
+}
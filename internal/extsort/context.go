@@ -4,7 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
@@ -21,6 +23,8 @@ var (
 	contextKeyFs                      = contextKeyType(3)
 	contextKeyUnhandledErrorHandler   = contextKeyType(4)
 	contextKeyUnhandledErrorDecorator = contextKeyType(5)
+	contextKeyStdio                   = contextKeyType(6)
+	contextKeyTempFilesStats          = contextKeyType(7)
 )
 
 type Logf = func(format string, args ...interface{})
@@ -78,6 +82,20 @@ func WithFs(ctx context.Context, fs env.Fs) context.Context {
 	return context.WithValue(ctx, contextKeyFs, fs)
 }
 
+// Stdio is used instead of files named StdioFilePath.
+type Stdio struct {
+	In  io.Reader
+	Out io.Writer
+}
+
+func GetStdio(ctx context.Context) Stdio {
+	return getContextValue(ctx, contextKeyStdio, Stdio{In: os.Stdin, Out: os.Stdout})
+}
+
+func WithStdio(ctx context.Context, stdio Stdio) context.Context {
+	return context.WithValue(ctx, contextKeyStdio, stdio)
+}
+
 func GetScope(ctx context.Context) string {
 	return getContextValue(ctx, contextKeyScope, "")
 }
@@ -0,0 +1,163 @@
+package extsort
+
+import (
+	"errors"
+	"strings"
+)
+
+// SplitCSVRecord splits the record into unquoted fields following RFC 4180 like encoding/csv does:
+// quoted fields may contain commas, newlines and doubled quotes. Malformed quoting is tolerated,
+// the text after the closing quote and the rest of the unclosed quoted field belong to the field.
+func SplitCSVRecord(record string, comma byte) []string {
+	fields := make([]string, 0)
+	for i := 0; ; i++ {
+		var field string
+		if i < len(record) && record[i] == '"' {
+			field, i = readQuotedCSVField(record, i+1, comma)
+		} else {
+			field, i = readCSVField(record, i, comma)
+		}
+		fields = append(fields, field)
+		if i >= len(record) {
+			return fields
+		}
+	}
+}
+
+func readCSVField(record string, begin int, comma byte) (string, int) {
+	end := strings.IndexByte(record[begin:], comma)
+	if end < 0 {
+		return record[begin:], len(record)
+	}
+	return record[begin : begin+end], begin + end
+}
+
+func readQuotedCSVField(record string, begin int, comma byte) (string, int) {
+	builder := strings.Builder{}
+	for i := begin; i < len(record); i++ {
+		if record[i] != '"' {
+			continue
+		}
+
+		if i+1 < len(record) && record[i+1] == '"' {
+			builder.WriteString(record[begin : i+1])
+			i++
+			begin = i + 1
+			continue
+		}
+
+		builder.WriteString(record[begin:i])
+		rest, end := readCSVField(record, i+1, comma)
+		builder.WriteString(rest)
+		return builder.String(), end
+	}
+
+	builder.WriteString(record[begin:])
+	return builder.String(), len(record)
+}
+
+// findCSVFields returns raw bounds of the fields from the first to the last one (zero last means the last field
+// of the record) without unquoting them, quoted reports whether some of them are quoted. The found is false
+// if the record has less than first fields.
+func findCSVFields(record string, comma byte, first, last int) (begin int, end int, quoted bool, found bool) {
+	i := 0
+	for field := 1; ; field++ {
+		fieldBegin := i
+		isQuoted := i < len(record) && record[i] == '"'
+		if isQuoted {
+			i = skipQuotedCSVField(record, i+1)
+		}
+		if idx := strings.IndexByte(record[i:], comma); idx < 0 {
+			i = len(record)
+		} else {
+			i += idx
+		}
+
+		if field == first {
+			begin, found = fieldBegin, true
+		}
+		if field >= first {
+			quoted = quoted || isQuoted
+		}
+		if field == last || i >= len(record) {
+			return begin, i, quoted, found
+		}
+		i++
+	}
+}
+
+// skipQuotedCSVField returns the position after the closing quote or the end of the record.
+func skipQuotedCSVField(record string, begin int) int {
+	for i := begin; i < len(record); i++ {
+		if record[i] != '"' {
+			continue
+		}
+		if i+1 < len(record) && record[i+1] == '"' {
+			i++
+			continue
+		}
+		return i + 1
+	}
+	return len(record)
+}
+
+var (
+	errCSVBareQuote = errors.New("has bare quote in unquoted field")
+	errCSVQuote     = errors.New("has extraneous quote in quoted field")
+)
+
+// csvScanner follows the quoting of a record across the slices it is read by, like encoding/csv does:
+// a quote opens a field only at its start and "" is the only escape inside the quoted field.
+type csvScanner struct {
+	comma      byte
+	crlf       bool
+	fieldStart bool
+	quoted     bool
+	quote      bool // a quote in the quoted field, it either closes the field or starts ""
+}
+
+func (this *csvScanner) reset() {
+	this.fieldStart, this.quoted, this.quote = true, false, false
+}
+
+// inQuotes reports whether the terminator read next is a part of the quoted field.
+func (this *csvScanner) inQuotes() bool {
+	return this.quoted && !this.quote
+}
+
+// scan follows the data, the last byte of the terminated data is the terminator.
+func (this *csvScanner) scan(data []byte, terminated bool) error {
+	if terminated {
+		data = data[:len(data)-1]
+	}
+
+	for _, b := range data {
+		switch {
+		case this.quote:
+			this.quote = false
+			switch {
+			case b == '"':
+			case b == this.comma:
+				this.quoted, this.fieldStart = false, true
+			case b == '\r' && this.crlf:
+				this.quoted = false
+			default:
+				return errCSVQuote
+			}
+		case this.quoted:
+			this.quote = b == '"'
+		case b == '"':
+			if !this.fieldStart {
+				return errCSVBareQuote
+			}
+			this.quoted, this.fieldStart = true, false
+		default:
+			this.fieldStart = b == this.comma
+		}
+	}
+
+	if terminated && this.quote {
+		this.quoted, this.quote = false, false
+	}
+	return nil
+}
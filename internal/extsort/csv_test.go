@@ -0,0 +1,37 @@
+package extsort
+
+import (
+	"encoding/csv"
+	"strings"
+	"testing"
+
+	"github.com/kdpdev/extsort/internal/utils/tests"
+)
+
+func Test_SplitCSVRecord(t *testing.T) {
+	cases := []string{
+		"a,b,c",
+		"",
+		",",
+		"a,,c,",
+		`"a,b",c`,
+		`"a ""quoted"" b",""`,
+		"\"multi\nline\",x",
+		`x,"",y`,
+	}
+
+	for _, record := range cases {
+		reader := csv.NewReader(strings.NewReader(record + "\n"))
+		reader.FieldsPerRecord = -1
+		expected, err := reader.Read()
+		if record == "" {
+			expected, err = []string{""}, nil
+		}
+		tests.CheckNotErrorf(t, err, "record '%v'", record)
+		tests.CheckExpectedf(t, strings.Join(expected, "|"), strings.Join(SplitCSVRecord(record, ','), "|"), "record '%v'", record)
+	}
+
+	tests.CheckExpected(t, "a|b;c|d", strings.Join(SplitCSVRecord(`a;"b;c";d`, ';'), "|"))
+	tests.CheckExpected(t, "ab c|d", strings.Join(SplitCSVRecord(`"ab" c,d`, ','), "|"))
+	tests.CheckExpected(t, "a|b,c", strings.Join(SplitCSVRecord(`a,"b,c`, ','), "|"))
+}
@@ -9,5 +9,6 @@ type Fs interface {
 	CreateWriteFile(filePath string) (io.WriteCloser, error)
 	OpenReadFile(filePath string) (io.ReadCloser, uint64, error)
 	MoveFile(src, dst string) error
+	Truncate(filePath string, size uint64) error
 	Remove(entryPath string) error
 }
@@ -160,6 +160,22 @@ func (this *MemFs) MoveFile(src, dst string) error {
 	return nil
 }
 
+func (this *MemFs) Truncate(filePath string, size uint64) error {
+	filePath, err := this.normalizePath(filePath)
+	if err != nil {
+		return err
+	}
+
+	defer this.lock()()
+
+	fileEntry := this.unsafeFindEntry(filePath)
+	if fileEntry == nil {
+		return os.ErrNotExist
+	}
+
+	return fileEntry.Truncate(size)
+}
+
 func (this *MemFs) Remove(entryPath string) error {
 	entryPath, err := this.normalizePath(entryPath)
 	if err != nil {
@@ -347,6 +363,26 @@ func (this *MemFsEntry) Open() (int, error) {
 	return len(this.data), nil
 }
 
+func (this *MemFsEntry) Truncate(size uint64) error {
+	defer this.lock()()
+
+	if !this.isFile {
+		return os.ErrInvalid
+	}
+
+	if !this.isClosed {
+		return os.ErrPermission
+	}
+
+	if size > uint64(len(this.data)) {
+		return os.ErrInvalid
+	}
+
+	this.data = this.data[:size]
+
+	return nil
+}
+
 func (this *MemFsEntry) IsFile() bool {
 	defer this.lock()()
 	return this.isFile
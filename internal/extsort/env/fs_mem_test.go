@@ -249,3 +249,28 @@ func TestMemFs_MoveFile(t *testing.T) {
 	tests.CheckNotError(t, err)
 	tests.CheckExpected(t, false, fs.HasOpenedEntries())
 }
+
+func TestMemFs_Truncate(t *testing.T) {
+	fs := NewMemFs(nil)
+
+	tests.CheckErrorIs(t, os.ErrNotExist, fs.Truncate("file", 0))
+
+	_, err := fs.EnsureDirExists("dir")
+	tests.CheckNotError(t, err)
+	tests.CheckErrorIs(t, os.ErrInvalid, fs.Truncate("dir", 0))
+
+	file, err := fs.CreateWriteFile("file")
+	tests.CheckNotError(t, err)
+	_, err = file.Write([]byte("data"))
+	tests.CheckNotError(t, err)
+	tests.CheckErrorIs(t, os.ErrPermission, fs.Truncate("file", 2))
+	tests.CheckNotError(t, file.Close())
+
+	tests.CheckErrorIs(t, os.ErrInvalid, fs.Truncate("file", 5))
+	tests.CheckNotError(t, fs.Truncate("file", 2))
+	fileSize, err := fs.GetFileSize("file")
+	tests.CheckNotError(t, err)
+	tests.CheckExpected(t, uint64(2), fileSize)
+
+	tests.CheckExpected(t, false, fs.HasOpenedEntries())
+}
@@ -30,6 +30,10 @@ func (this *mockFs) MoveFile(_, _ string) error {
 	return this.methodError()
 }
 
+func (this *mockFs) Truncate(string, uint64) error {
+	return this.methodError()
+}
+
 func (this *mockFs) Remove(string) error {
 	return this.methodError()
 }
@@ -54,6 +54,10 @@ func (this *osFs) MoveFile(src, dst string) error {
 	return os.Rename(src, dst)
 }
 
+func (this *osFs) Truncate(filePath string, size uint64) error {
+	return os.Truncate(filePath, int64(size))
+}
+
 func (this *osFs) Remove(entryPath string) error {
 	return os.Remove(entryPath)
 }
@@ -8,5 +8,7 @@ var (
 	ErrBadConfig                   = errors.New("bad config")
 	ErrNoFiles                     = errors.New("no files")
 	ErrNotSorted                   = errors.New("not sorted")
+	ErrRecordTooLong               = errors.New("record too long")
+	ErrBadRecord                   = errors.New("bad record")
 	ErrUnexpectedWrittenBytesCount = errors.New("unexpected written bytes count")
 )
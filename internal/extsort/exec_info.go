@@ -2,20 +2,48 @@ package extsort
 
 import "time"
 
+// ExecInfo describes the finished sorting. InputFileSize is the total size of all inputs as they are
+// read (compressed if they are gzipped). OutputFileSize equals InputFileSize except for these cases:
+//   - duplicates are removed by the unique sort;
+//   - the headers of all the inputs but the first one are dropped;
+//   - the terminator is added to every input which ends without it, except the last input
+//     if RecordFormat.KeepMissingTerminator is set;
+//   - records of the CRLF format are written terminated by "\r\n", so each one read with a bare '\n'
+//     grows by '\r' and the added terminators take two bytes;
+//   - varint length prefixes are written in the shortest form, so longer encoded prefixes shrink;
+//   - either the inputs or the output are gzipped.
 type ExecInfo struct {
 	TempDir            string
 	InputFile          string
+	InputFiles         []string
 	OutputFile         string
 	InputFileSize      uint64
 	OutputFileSize     uint64
+	MissingTerminator  bool // the (last) input does not end with the terminator
 	WorkersCount       int
 	WorkerReadBufSize  int
 	WorkerWriteBufSize int
 	PreferredChunkSize int
 	ChunkCapacity      int
+	Unique             bool
+	Stable             bool
+	MergeOnly          bool
+	GzipOutput         bool
+	CompressTempFiles  bool
+	RemovedDuplicates  uint64
 	SplittingDuration  time.Duration
 	MergingDuration    time.Duration
 	ExecDuration       time.Duration
+
+	// The cost of temp files: the compression saves TempDataSize-TempFilesSize bytes of the I/O
+	// for the TempCodecDuration of the CPU time, the TempIODuration is the time of the I/O itself
+	// (both are summed over workers). Sizes are cumulative bytes written by all the splitting and
+	// merging, not the peak space the TempDir takes.
+	TempDataSize         uint64
+	TempFilesSize        uint64
+	TempCompressionRatio float64
+	TempCodecDuration    time.Duration
+	TempIODuration       time.Duration
 }
 
 func ExecInfoFromConfig(cfg Config) ExecInfo {
@@ -23,10 +51,16 @@ func ExecInfoFromConfig(cfg Config) ExecInfo {
 		TempDir:            cfg.TempDir,
 		OutputFile:         cfg.OutputFilePath,
 		InputFile:          cfg.InputFilePath,
+		InputFiles:         cfg.InputFilePaths,
 		WorkersCount:       cfg.WorkersCount,
 		WorkerReadBufSize:  cfg.WorkerReadBufSize,
 		WorkerWriteBufSize: cfg.WorkerWriteBufSize,
 		PreferredChunkSize: cfg.PreferredChunkSize,
 		ChunkCapacity:      cfg.ChunkCapacity,
+		Unique:             cfg.Unique,
+		Stable:             cfg.Stable,
+		MergeOnly:          cfg.MergeOnly,
+		GzipOutput:         cfg.GzipOutput,
+		CompressTempFiles:  cfg.CompressTempFiles,
 	}
 }
@@ -1,12 +1,19 @@
 package extsort
 
 import (
+	"bufio"
+	"compress/gzip"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/kdpdev/extsort/internal/extsort/env"
 	"github.com/kdpdev/extsort/internal/utils/alg"
 	"github.com/kdpdev/extsort/internal/utils/misc"
 )
@@ -27,89 +34,281 @@ func ExecExtSort(ctx context.Context, cfg Config) (err error) {
 	ctx, logf := WithPrefixedLogger(ctx, "extsort")
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
+	ctx, getTempFilesStats := WithTempFilesStatsCollector(ctx)
 
 	logf("config: %v", misc.ToPrettyString(cfg))
 
+	removedDuplicates := atomic.Uint64{}
+	onDuplicatesRemoved := func(count int) {
+		removedDuplicates.Add(uint64(count))
+	}
+
 	execInfo := ExecInfoFromConfig(cfg)
 	defer misc.InvokeIfNotError(&err, func() {
 		logf("Exec info: %v", misc.ToPrettyString(execInfo))
 	})
 
-	splittingDuration, chunkFiles, err := misc.MeasureCallRE(func() (_ []string, splittingErr error) {
+	consumedInputSize := atomic.Uint64{}
+	splittingDuration, split, err := misc.MeasureCallRE(func() (_ splitResult, splittingErr error) {
 		splittingCtx, _ := WithPrefixedLogger(ctx, "splitting")
 
-		inputFileSize, splittingErr := GetFs(splittingCtx).GetFileSize(cfg.InputFilePath)
+		inputFilePaths := cfg.GetInputFilePaths()
+		inputSize, inputSizeKnown, splittingErr := getInputsSize(splittingCtx, inputFilePaths)
 		if splittingErr != nil {
-			return nil, splittingErr
+			return splitResult{}, splittingErr
 		}
 
-		updateProgress, finishProgress := makeSplittingProgress(inputFileSize)
+		updateProgress, finishProgress := makeSplittingProgress(inputSize, inputSizeKnown, &consumedInputSize)
 		defer func() { finishProgress(splittingCtx, splittingErr) }()
 
-		opts := SplittingOptions{
-			OutputDir:          cfg.TempDir,
-			ChunkCapacity:      cfg.ChunkCapacity,
-			PreferredChunkSize: cfg.PreferredChunkSize,
-			WriteBufSize:       cfg.WorkerWriteBufSize,
-			ReadBufSize:        cfg.WorkerReadBufSize,
-			WorkersCount:       cfg.WorkersCount,
+		open := func(ctx context.Context, idx int) (io.ReadCloser, error) {
+			return openInput(ctx, inputFilePaths[idx], &consumedInputSize, cfg.WorkerReadBufSize)
 		}
-
-		return SplitFileToSortedChunks(splittingCtx, cfg.InputFilePath, opts, updateProgress)
+		return splitInputs(splittingCtx, inputFilePaths, open, &cfg, onDuplicatesRemoved, updateProgress)
 	})
 
 	if err != nil {
 		return err
 	}
+	defer misc.InvokeIfError(&err, func() { closeSortedInputs(ctx, split.sortedInputs) })
 
-	mergingDuration, mergedFilePath, err := misc.MeasureCallRE(func() (_ string, mergingErr error) {
+	streamOutput := cfg.OutputFilePath == StdioFilePath || cfg.GzipOutput || cfg.CompressTempFiles ||
+		split.hasHeader || split.sortedInputs != nil // the header is written before the merge
+	mergedFilePath := ""
+	mergingDuration, err := misc.MeasureCallE(func() (mergingErr error) {
 		mergingCtx, _ := WithPrefixedLogger(ctx, "merging")
 
-		opts := MergeOptions{
-			OutputDir:    cfg.TempDir,
-			ReadBufSize:  cfg.WorkerReadBufSize,
-			WriteBufSize: cfg.WorkerWriteBufSize,
-			WorkersCount: cfg.WorkersCount,
-		}
+		opts := cfg.mergeOptions(split.compare, onDuplicatesRemoved)
 
-		updateProgress, finishProgress := makeMergeProgress(uint64(alg.Max(len(chunkFiles)-1, 0)))
+		updateProgress, finishProgress := makeMergeProgress(uint64(alg.Max(len(split.chunkFiles)-1, 0)))
 		defer func() { finishProgress(mergingCtx, mergingErr) }()
 
-		return Merge(mergingCtx, chunkFiles, opts, updateProgress)
+		if streamOutput {
+			execInfo.OutputFileSize, mergingErr = writeOutput(mergingCtx, split, cfg, opts, updateProgress)
+			return mergingErr
+		}
+
+		mergedFilePath, mergingErr = Merge(mergingCtx, split.chunkFiles, opts, updateProgress)
+		return mergingErr
 	})
 	if err != nil {
 		return err
 	}
 
+	if !streamOutput {
+		execInfo.OutputFileSize, err = moveMergedFile(ctx, mergedFilePath, split, cfg)
+		if err != nil {
+			return err
+		}
+	}
+
+	execInfo.InputFileSize = consumedInputSize.Load() // the sorted inputs are consumed by the merging
+	execInfo.MissingTerminator = split.isMissingTerminator()
+
+	endExecution := time.Now().UnixMicro()
+	execInfo.RemovedDuplicates = removedDuplicates.Load()
+	execInfo.SplittingDuration = splittingDuration
+	execInfo.MergingDuration = mergingDuration
+	execInfo.ExecDuration = time.Microsecond * time.Duration(endExecution-beginExecution)
+
+	tempFilesStats := getTempFilesStats()
+	execInfo.TempDataSize = tempFilesStats.DataSize
+	execInfo.TempFilesSize = tempFilesStats.FilesSize
+	execInfo.TempCompressionRatio = tempFilesStats.CompressionRatio()
+	execInfo.TempCodecDuration = tempFilesStats.CodecDuration
+	execInfo.TempIODuration = tempFilesStats.IODuration
+
+	return nil
+}
+
+// openInput opens the input file or stdin and decompresses it if it is gzipped,
+// the consumed counts the bytes read from the input before the decompression.
+func openInput(ctx context.Context, filePath string, consumed *atomic.Uint64, bufSize int) (_ io.ReadCloser, err error) {
+	var input io.ReadCloser
+	if filePath == StdioFilePath {
+		input = io.NopCloser(GetStdio(ctx).In)
+	} else {
+		input, _, err = GetFs(ctx).OpenReadFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	counted := &readCloser{Reader: &countingReader{reader: input, count: consumed}, close: input.Close}
+	decompressed, err := newDecompressingReader(counted, filePath, bufSize)
+	if err != nil {
+		if e := input.Close(); e != nil {
+			OnUnhandledError(ctx, e)
+		}
+		return nil, err
+	}
+
+	return decompressed, nil
+}
+
+// writeOutput streams the final merge to the output file or stdout, the output is gzipped if the config requires.
+func writeOutput(ctx context.Context, split splitResult, cfg Config, opts MergeOptions,
+	updateProgress MergingProgressListener) (outputSize uint64, err error) {
+
+	fs := GetFs(ctx)
+	onceErr := misc.NewOnceError(&err)
+	onceErr = misc.NewOnceEventWithNotSetNotification(onceErr, GetContextedUnhandledErrorHandler(ctx))
+
+	var output io.Writer = GetStdio(ctx).Out
+	if cfg.OutputFilePath != StdioFilePath {
+		file, e := fs.CreateWriteFile(cfg.OutputFilePath)
+		if e != nil {
+			return 0, e
+		}
+		defer misc.InvokeIfError(&err, func() {
+			if e := fs.Remove(cfg.OutputFilePath); e != nil {
+				OnUnhandledError(ctx, e)
+			}
+		})
+		defer onceErr.Invoke(file.Close)
+		output = file
+	}
+
+	counter := &countingWriter{writer: output}
+	if !cfg.GzipOutput {
+		err = writeMerged(ctx, counter, split, cfg, opts, updateProgress)
+		return counter.written, err
+	}
+
+	gzipWriter, err := gzip.NewWriterLevel(counter, cfg.GzipLevel)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = writeMerged(ctx, gzipWriter, split, cfg, opts, updateProgress); err != nil {
+		return 0, err
+	}
+
+	if err = gzipWriter.Close(); err != nil {
+		return 0, err
+	}
+
+	return counter.written, nil
+}
+
+// getInputsSize returns the total size of input files, the size of stdin is unknown.
+func getInputsSize(ctx context.Context, filePaths []string) (size uint64, known bool, err error) {
+	fs := GetFs(ctx)
+	known = true
+	for _, filePath := range filePaths {
+		if filePath == StdioFilePath {
+			known = false
+			continue
+		}
+
+		fileSize, err := fs.GetFileSize(filePath)
+		if err != nil {
+			return 0, false, err
+		}
+		size += fileSize
+	}
+	return size, known, nil
+}
+
+// moveMergedFile moves the merged file to the output without the last terminator
+// if the input misses it and the format keeps it missing.
+func moveMergedFile(ctx context.Context, mergedFilePath string, split splitResult, cfg Config) (outputSize uint64, err error) {
+	logf := GetLogger(ctx)
 	fs := GetFs(ctx)
 
 	logf("moving: '%v' -> '%v'...", mergedFilePath, cfg.OutputFilePath)
 	err = fs.MoveFile(mergedFilePath, cfg.OutputFilePath)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	logf("moving: done")
 
-	execInfo.InputFileSize, err = fs.GetFileSize(cfg.InputFilePath)
-	if err != nil {
-		return err
+	if split.isMissingTerminator() && cfg.RecordFormat.KeepMissingTerminator {
+		err = removeLastTerminator(fs, cfg.OutputFilePath, cfg.RecordFormat)
+		if err != nil {
+			return 0, err
+		}
 	}
 
-	execInfo.OutputFileSize, err = fs.GetFileSize(cfg.OutputFilePath)
+	return fs.GetFileSize(cfg.OutputFilePath)
+}
+
+// readHeaderAndResolveKeys reads the header if the format has it and resolves key names by it.
+func readHeaderAndResolveKeys(reader *bufio.Reader, cfg *Config) (header string, found bool, err error) {
+	if !cfg.RecordFormat.Header {
+		return "", false, nil
+	}
+
+	header, err = cfg.GetFraming().NewReader(reader).ReadRecord()
+	if errors.Is(err, io.EOF) {
+		header, err = "", nil
+	} else if err != nil {
+		return "", false, err
+	} else {
+		found = true
+	}
+
+	cfg.Keys, err = ResolveKeyNames(cfg.Keys, cfg.HeaderColumns(header))
+	return header, found, err
+}
+
+func (this Config) splittingOptions(cmp Compare, onDuplicatesRemoved func(count int)) SplittingOptions {
+	return SplittingOptions{
+		OutputDir:          this.TempDir,
+		ChunkCapacity:      this.ChunkCapacity,
+		PreferredChunkSize: this.PreferredChunkSize,
+		WriteBufSize:       this.WorkerWriteBufSize,
+		ReadBufSize:        this.WorkerReadBufSize,
+		WorkersCount:       this.WorkersCount,
+		Compare:            cmp,
+		RecordKey:          this.GetRecordKey(),
+		Unique:             this.Unique,
+		Stable:             this.Stable,
+		Framing:            this.GetFraming(),
+		CheckRecord:        this.GetRecordCheck(),
+		Compress:           this.CompressTempFiles,
+
+		OnDuplicatesRemoved: onDuplicatesRemoved,
+	}
+}
+
+func (this Config) mergeOptions(cmp Compare, onDuplicatesRemoved func(count int)) MergeOptions {
+	return MergeOptions{
+		OutputDir:    this.TempDir,
+		ReadBufSize:  this.WorkerReadBufSize,
+		WriteBufSize: this.WorkerWriteBufSize,
+		WorkersCount: this.WorkersCount,
+		Compare:      cmp,
+		RecordKey:    this.GetRecordKey(),
+		Unique:       this.Unique,
+		Framing:      this.GetFraming(),
+		Compress:     this.CompressTempFiles,
+
+		OnDuplicatesRemoved: onDuplicatesRemoved,
+	}
+}
+
+func removeLastTerminator(fs env.Fs, filePath string, format RecordFormat) error {
+	fileSize, err := fs.GetFileSize(filePath)
 	if err != nil {
 		return err
 	}
 
-	endExecution := time.Now().UnixMicro()
-	execInfo.SplittingDuration = splittingDuration
-	execInfo.MergingDuration = mergingDuration
-	execInfo.ExecDuration = time.Microsecond * time.Duration(endExecution-beginExecution)
+	terminatorSize := uint64(len(format.SerializedTerminator()))
+	if fileSize < terminatorSize {
+		return nil
+	}
 
-	return nil
+	return fs.Truncate(filePath, fileSize-terminatorSize)
 }
 
-func makeSplittingProgress(max uint64) (update SplittingProgressListener, finish func(ctx context.Context, finishResult error)) {
+// makeSplittingProgress logs percents of the consumed input bytes of the max, only consumed bytes
+// are logged if the max is unknown.
+func makeSplittingProgress(max uint64, maxKnown bool, consumed *atomic.Uint64) (update SplittingProgressListener, finish func(ctx context.Context, finishResult error)) {
 	logMsgFmt := fmt.Sprintf("progress: %%3v%%%% %%%vv/%v %%v [%%v bytes]", len(fmt.Sprintf("%v", max)), max)
+	if !maxKnown {
+		max = math.MaxUint64
+	}
 	progress := misc.NewUnsafeProgress(max)
 	guard := &sync.Mutex{}
 
@@ -120,8 +319,12 @@ func makeSplittingProgress(max uint64) (update SplittingProgressListener, finish
 		guard.Lock()
 		defer guard.Unlock()
 
-		percents, value, _ := progress.Add(chunkSize)
-		logf(logMsgFmt, percents, value, filepath.Base(filePath), chunkSize)
+		percents, value, _ := progress.Add(consumed.Load() - progress.Value())
+		if maxKnown {
+			logf(logMsgFmt, percents, value, filepath.Base(filePath), chunkSize)
+		} else {
+			logf("progress: %v %v [%v bytes]", value, filepath.Base(filePath), chunkSize)
+		}
 
 		return nil
 	}
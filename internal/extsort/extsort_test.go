@@ -1,11 +1,13 @@
 package extsort
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"sort"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -16,8 +18,7 @@ import (
 func Test_ExtSort_1(t *testing.T) {
 	tools, cfg := newExtSortTools(t)
 	tests.CheckErrorIs(t, os.ErrNotExist, ExecExtSort(tools.Ctx, cfg))
-	tests.CheckExpected(t, 0, len(tools.UnhandledErrs()))
-	tests.CheckExpected(t, false, tools.Fs.HasOpenedEntries())
+	tools.CheckReleased(t)
 }
 
 func Test_ExtSort_2(t *testing.T) {
@@ -26,8 +27,7 @@ func Test_ExtSort_2(t *testing.T) {
 	tests.CheckNotError(t, ExecExtSort(tools.Ctx, cfg))
 	tests.CheckNotError(t, tools.CheckFileSize(cfg.OutputFilePath, 0))
 	tests.CheckNotError(t, tools.CheckFileSize(cfg.InputFilePath, 0))
-	tests.CheckExpected(t, 0, len(tools.UnhandledErrs()))
-	tests.CheckExpected(t, false, tools.Fs.HasOpenedEntries())
+	tools.CheckReleased(t)
 }
 
 func Test_ExtSort_3(t *testing.T) {
@@ -53,23 +53,679 @@ func Test_ExtSort_3(t *testing.T) {
 	tests.CheckNotError(t, ExecExtSort(tools.Ctx, cfg))
 	tests.CheckNotError(t, tools.CheckFileSize(cfg.OutputFilePath, uint64(len(linesTxt))))
 
-	merged, size, err := tools.Fs.OpenReadFile(cfg.OutputFilePath)
-	tests.CheckNotError(t, err)
-	tests.CheckExpected(t, uint64(len(linesTxt)), size)
-
-	mergedData, err := ioutil.ReadAll(merged)
-	tests.CheckNotError(t, err)
-	tests.CheckNotError(t, merged.Close())
-
-	mergedStr := string(mergedData)
+	mergedStr := tools.ReadFile(t, cfg.OutputFilePath)
 
 	sort.Strings(linesArr)
 	linesTxt = strings.Join(linesArr, "\n") + "\n"
 
 	tests.CheckExpected(t, linesTxt, mergedStr)
 
-	tests.CheckExpected(t, 0, len(tools.UnhandledErrs()))
+	tools.CheckReleased(t)
+}
+
+func Test_ExtSort_Compare(t *testing.T) {
+	tools, cfg := newExtSortTools(t)
+
+	linesArr := make([]string, 0, 5000)
+	for i := 0; i < 5000; i++ {
+		linesArr = append(linesArr, strconv.Itoa(i))
+	}
+	linesTxt := strings.Join(linesArr, "\n") + "\n"
+	tests.CheckNotError(t, tools.CreateFile(cfg.InputFilePath, linesTxt))
+
+	cfg.WorkerWriteBufSize = 1024
+	cfg.WorkerReadBufSize = 1024
+	cfg.ChunkCapacity = 1024
+	cfg.PreferredChunkSize = 1024
+	cfg.Compare = func(lhs, rhs string) int {
+		l, _ := strconv.Atoi(lhs)
+		r, _ := strconv.Atoi(rhs)
+		return r - l
+	}
+	tests.CheckNotError(t, ExecExtSort(tools.Ctx, cfg))
+
+	mergedData := tools.ReadFile(t, cfg.OutputFilePath)
+
+	sort.Slice(linesArr, func(i, j int) bool {
+		return cfg.Compare(linesArr[i], linesArr[j]) < 0
+	})
+	tests.CheckExpected(t, strings.Join(linesArr, "\n")+"\n", mergedData)
+
+	tools.CheckReleased(t)
+}
+
+func Test_ExtSort_Keys(t *testing.T) {
+	tools, cfg := newExtSortTools(t)
+
+	linesArr := make([]string, 0, 2000)
+	for i := 0; i < 2000; i++ {
+		linesArr = append(linesArr, fmt.Sprintf("%04v;%04v", i, 2000-i))
+	}
+	linesTxt := strings.Join(linesArr, "\n") + "\n"
+	tests.CheckNotError(t, tools.CreateFile(cfg.InputFilePath, linesTxt))
+
+	cfg.WorkerWriteBufSize = 1024
+	cfg.WorkerReadBufSize = 1024
+	cfg.ChunkCapacity = 1024
+	cfg.PreferredChunkSize = 1024
+	cfg.FieldSeparator = ";"
+	cfg.Keys = []Key{{StartField: 2, EndField: 2}}
+	tests.CheckNotError(t, ExecExtSort(tools.Ctx, cfg))
+
+	mergedData := tools.ReadFile(t, cfg.OutputFilePath)
+
+	for i, j := 0, len(linesArr)-1; i < j; i, j = i+1, j-1 {
+		linesArr[i], linesArr[j] = linesArr[j], linesArr[i]
+	}
+	tests.CheckExpected(t, strings.Join(linesArr, "\n")+"\n", mergedData)
+
+	tools.CheckReleased(t)
+}
+
+func Test_ExtSort_Reverse(t *testing.T) {
+	tools, cfg := newExtSortTools(t)
+
+	linesArr := make([]string, 0, 2000)
+	for i := 0; i < 2000; i++ {
+		linesArr = append(linesArr, fmt.Sprintf("%04v", i))
+	}
+	linesTxt := strings.Join(linesArr, "\n") + "\n"
+	tests.CheckNotError(t, tools.CreateFile(cfg.InputFilePath, linesTxt))
+
+	cfg.WorkerWriteBufSize = 1024
+	cfg.WorkerReadBufSize = 1024
+	cfg.ChunkCapacity = 1024
+	cfg.PreferredChunkSize = 1024
+	cfg.Reverse = true
+	tests.CheckNotError(t, ExecExtSort(tools.Ctx, cfg))
+
+	mergedData := tools.ReadFile(t, cfg.OutputFilePath)
+
+	sort.Sort(sort.Reverse(sort.StringSlice(linesArr)))
+	tests.CheckExpected(t, strings.Join(linesArr, "\n")+"\n", mergedData)
+
+	tools.CheckReleased(t)
+}
+
+func Test_ExtSort_Unique(t *testing.T) {
+	tools, cfg := newExtSortTools(t)
+
+	linesArr := make([]string, 0, 3000)
+	for i := 0; i < 3000; i++ {
+		linesArr = append(linesArr, fmt.Sprintf("%04v", i%1000))
+	}
+	linesTxt := strings.Join(linesArr, "\n") + "\n"
+	tests.CheckNotError(t, tools.CreateFile(cfg.InputFilePath, linesTxt))
+
+	cfg.WorkerWriteBufSize = 1024
+	cfg.WorkerReadBufSize = 1024
+	cfg.ChunkCapacity = 1024
+	cfg.PreferredChunkSize = 1024
+	cfg.Unique = true
+	tests.CheckNotError(t, ExecExtSort(tools.Ctx, cfg))
+
+	mergedData := tools.ReadFile(t, cfg.OutputFilePath)
+
+	expected := ""
+	for i := 0; i < 1000; i++ {
+		expected += fmt.Sprintf("%04v\n", i)
+	}
+	tests.CheckExpected(t, expected, mergedData)
+	tools.CheckReleased(t)
+}
+
+func Test_ExtSort_UniqueKeys(t *testing.T) {
+	cases := []struct {
+		keys     string
+		mode     CompareMode
+		input    string
+		expected string
+	}{
+		{"1,1", CompareModeBytes, "b 1\na y\na x\nb 0\na x\n", "a y\nb 1\n"},
+		{"", CompareModeNumeric, "01\n2\n1\n002\n1.0\n", "01\n2\n"},
+		{"2n", CompareModeBytes, "x 1\ny 01\nz 1\nw 2\n", "x 1\nw 2\n"},
+	}
+
+	for i, c := range cases {
+		tools, cfg := newExtSortTools(t)
+		tests.CheckNotError(t, tools.CreateFile(cfg.InputFilePath, c.input))
+
+		cfg.ChunkCapacity = 2
+		cfg.PreferredChunkSize = 8
+		cfg.Unique = true
+		cfg.CompareMode = c.mode
+		if c.keys != "" {
+			keys, err := ParseKeys(c.keys)
+			tests.CheckNotError(t, err)
+			cfg.Keys = keys
+		}
+		tests.CheckNotErrorf(t, ExecExtSort(tools.Ctx, cfg), "case %v", i)
+
+		tests.CheckExpectedf(t, c.expected, tools.ReadFile(t, cfg.OutputFilePath), "case %v", i)
+
+		tools.CheckReleased(t)
+	}
+}
+
+func Test_ExtSort_Stable(t *testing.T) {
+	tools, cfg := newExtSortTools(t)
+
+	linesArr := make([]string, 0, 3000)
+	for i := 0; i < 3000; i++ {
+		linesArr = append(linesArr, fmt.Sprintf("%02v;%04v", (i*7)%50, 3000-i))
+	}
+	linesTxt := strings.Join(linesArr, "\n") + "\n"
+	tests.CheckNotError(t, tools.CreateFile(cfg.InputFilePath, linesTxt))
+
+	cfg.WorkerWriteBufSize = 1024
+	cfg.WorkerReadBufSize = 1024
+	cfg.ChunkCapacity = 1024
+	cfg.PreferredChunkSize = 1024
+	cfg.FieldSeparator = ";"
+	cfg.Keys = []Key{{StartField: 1, EndField: 1}}
+	cfg.Stable = true
+	tests.CheckNotError(t, ExecExtSort(tools.Ctx, cfg))
+
+	mergedData := tools.ReadFile(t, cfg.OutputFilePath)
+
+	sort.SliceStable(linesArr, func(i, j int) bool {
+		return linesArr[i][:2] < linesArr[j][:2]
+	})
+	tests.CheckExpected(t, strings.Join(linesArr, "\n")+"\n", mergedData)
+
+	tools.CheckReleased(t)
+}
+
+func Test_ExtSort_Numeric(t *testing.T) {
+	tools, cfg := newExtSortTools(t)
+
+	linesArr := make([]string, 0, 3000)
+	for i := 0; i < 3000; i++ {
+		linesArr = append(linesArr, strconv.Itoa((i*7919)%3000-1500))
+	}
+	linesTxt := strings.Join(linesArr, "\n") + "\n"
+	tests.CheckNotError(t, tools.CreateFile(cfg.InputFilePath, linesTxt))
+
+	cfg.WorkerWriteBufSize = 1024
+	cfg.WorkerReadBufSize = 1024
+	cfg.ChunkCapacity = 1024
+	cfg.PreferredChunkSize = 1024
+	cfg.CompareMode = CompareModeNumeric
+	tests.CheckNotError(t, ExecExtSort(tools.Ctx, cfg))
+
+	mergedData := tools.ReadFile(t, cfg.OutputFilePath)
+
+	expected := ""
+	for i := -1500; i < 1500; i++ {
+		expected += strconv.Itoa(i) + "\n"
+	}
+	tests.CheckExpected(t, expected, mergedData)
+
+	tools.CheckReleased(t)
+}
+
+func Test_ExtSort_MultiKey(t *testing.T) {
+	tools, cfg := newExtSortTools(t)
+
+	linesArr := make([]string, 0, 3000)
+	for i := 0; i < 3000; i++ {
+		linesArr = append(linesArr, fmt.Sprintf("%v\tname_%v\t%v", i, i%7, (i*31)%1000))
+	}
+	linesTxt := strings.Join(linesArr, "\n") + "\n"
+	tests.CheckNotError(t, tools.CreateFile(cfg.InputFilePath, linesTxt))
+
+	cfg.WorkerWriteBufSize = 1024
+	cfg.WorkerReadBufSize = 1024
+	cfg.ChunkCapacity = 1024
+	cfg.PreferredChunkSize = 1024
+	cfg.FieldSeparator = "\t"
+	cfg.Keys = []Key{
+		{StartField: 2, EndField: 2},
+		{StartField: 3, EndField: 3, KeyOptions: KeyOptions{Mode: CompareModeNumeric, Reverse: true}},
+	}
+	tests.CheckNotError(t, ExecExtSort(tools.Ctx, cfg))
+
+	mergedData := tools.ReadFile(t, cfg.OutputFilePath)
+
+	sort.Slice(linesArr, func(i, j int) bool {
+		lhs := strings.Split(linesArr[i], "\t")
+		rhs := strings.Split(linesArr[j], "\t")
+		if lhs[1] != rhs[1] {
+			return lhs[1] < rhs[1]
+		}
+		lhsNum, _ := strconv.Atoi(lhs[2])
+		rhsNum, _ := strconv.Atoi(rhs[2])
+		if lhsNum != rhsNum {
+			return lhsNum > rhsNum
+		}
+		return linesArr[i] < linesArr[j]
+	})
+	tests.CheckExpected(t, strings.Join(linesArr, "\n")+"\n", mergedData)
+
+	tools.CheckReleased(t)
+}
+
+func Test_ExtSort_ZeroTerminated(t *testing.T) {
+	tools, cfg := newExtSortTools(t)
+
+	linesArr := make([]string, 0, 2000)
+	for i := 0; i < 2000; i++ {
+		linesArr = append(linesArr, fmt.Sprintf("%04v\nline", 2000-i))
+	}
+	linesTxt := strings.Join(linesArr, "\x00") + "\x00"
+	tests.CheckNotError(t, tools.CreateFile(cfg.InputFilePath, linesTxt))
+
+	cfg.WorkerWriteBufSize = 1024
+	cfg.WorkerReadBufSize = 1024
+	cfg.ChunkCapacity = 1024
+	cfg.PreferredChunkSize = 1024
+	cfg.RecordFormat.ZeroTerminated = true
+	tests.CheckNotError(t, ExecExtSort(tools.Ctx, cfg))
+
+	mergedData := tools.ReadFile(t, cfg.OutputFilePath)
+
+	sort.Strings(linesArr)
+	tests.CheckExpected(t, strings.Join(linesArr, "\x00")+"\x00", mergedData)
+
+	tools.CheckReleased(t)
+}
+
+func Test_ExtSort_LongLines(t *testing.T) {
+	tools, cfg := newExtSortTools(t)
+
+	linesArr := make([]string, 0, 20)
+	for i := 0; i < 20; i++ {
+		linesArr = append(linesArr, strings.Repeat(strconv.Itoa(20-i), 100*1024))
+	}
+	linesTxt := strings.Join(linesArr, "\n") + "\n"
+	tests.CheckNotError(t, tools.CreateFile(cfg.InputFilePath, linesTxt))
+
+	cfg.RecordFormat.MaxRecordSize = 100 * 1024
+	tests.CheckErrorIs(t, ErrRecordTooLong, ExecExtSort(tools.Ctx, cfg))
+	tests.CheckNotError(t, tools.CheckAbsent(cfg.OutputFilePath))
+
+	cfg.RecordFormat.MaxRecordSize = 0
+	tests.CheckNotError(t, ExecExtSort(tools.Ctx, cfg))
+
+	mergedData := tools.ReadFile(t, cfg.OutputFilePath)
+
+	sort.Strings(linesArr)
+	tests.CheckExpected(t, strings.Join(linesArr, "\n")+"\n", mergedData)
+
+	tools.CheckReleased(t)
+}
+
+func Test_ExtSort_CRLF(t *testing.T) {
+	tools, cfg := newExtSortTools(t)
+
+	linesArr := make([]string, 0, 2000)
+	for i := 0; i < 2000; i++ {
+		linesArr = append(linesArr, fmt.Sprintf("%04v", 2000-i))
+	}
+	linesTxt := strings.Join(linesArr, "\r\n") + "\r\n"
+	tests.CheckNotError(t, tools.CreateFile(cfg.InputFilePath, linesTxt))
+
+	cfg.WorkerWriteBufSize = 1024
+	cfg.WorkerReadBufSize = 1024
+	cfg.ChunkCapacity = 1024
+	cfg.PreferredChunkSize = 1024
+	cfg.RecordFormat.CRLF = true
+	tests.CheckNotError(t, ExecExtSort(tools.Ctx, cfg))
+	tests.CheckNotError(t, tools.CheckFileSize(cfg.OutputFilePath, uint64(len(linesTxt))))
+
+	mergedData := tools.ReadFile(t, cfg.OutputFilePath)
+
+	sort.Strings(linesArr)
+	tests.CheckExpected(t, strings.Join(linesArr, "\r\n")+"\r\n", mergedData)
+
+	tools.CheckReleased(t)
+}
+
+func Test_ExtSort_MissingTerminator(t *testing.T) {
+	cases := []struct {
+		format   RecordFormat
+		input    string
+		expected string
+	}{
+		{RecordFormat{}, "c\nb\na", "a\nb\nc\n"},
+		{RecordFormat{KeepMissingTerminator: true}, "c\nb\na", "a\nb\nc"},
+		{RecordFormat{KeepMissingTerminator: true}, "c\nb\na\n", "a\nb\nc\n"},
+		{RecordFormat{KeepMissingTerminator: true}, "", ""},
+		{RecordFormat{CRLF: true}, "c\r\nb\r\na", "a\r\nb\r\nc\r\n"},
+		{RecordFormat{CRLF: true, KeepMissingTerminator: true}, "c\r\nb\r\na", "a\r\nb\r\nc"},
+		{RecordFormat{ZeroTerminated: true, KeepMissingTerminator: true}, "c\x00b\x00a", "a\x00b\x00c"},
+	}
+
+	for i, c := range cases {
+		tools, cfg := newExtSortTools(t)
+		tests.CheckNotError(t, tools.CreateFile(cfg.InputFilePath, c.input))
+
+		cfg.RecordFormat = c.format
+		tests.CheckNotErrorf(t, ExecExtSort(tools.Ctx, cfg), "case %v", i)
+
+		tests.CheckExpectedf(t, c.expected, tools.ReadFile(t, cfg.OutputFilePath), "case %v", i)
+
+		tools.CheckReleased(t)
+	}
+}
+
+func Test_ExtSort_Stdio(t *testing.T) {
+	linesArr := make([]string, 0, 2000)
+	for i := 0; i < 2000; i++ {
+		linesArr = append(linesArr, fmt.Sprintf("%05v", 2000-i))
+	}
+	header := "n"
+	linesTxt := header + "\n" + strings.Join(linesArr, "\n")
+	sort.Strings(linesArr)
+	expected := header + "\n" + strings.Join(linesArr, "\n")
+
+	for _, paths := range [][2]string{{StdioFilePath, StdioFilePath}, {StdioFilePath, "output"}, {"input", StdioFilePath}} {
+		tools, cfg := newExtSortTools(t)
+		cfg.InputFilePath, cfg.OutputFilePath = paths[0], paths[1]
+		cfg.ChunkCapacity = 1024
+		cfg.PreferredChunkSize = 1024
+		cfg.RecordFormat = RecordFormat{Header: true, KeepMissingTerminator: true}
+
+		in, out := strings.NewReader(linesTxt), &bytes.Buffer{}
+		ctx := WithStdio(tools.Ctx, Stdio{In: in, Out: out})
+		if cfg.InputFilePath != StdioFilePath {
+			tests.CheckNotError(t, tools.CreateFile(cfg.InputFilePath, linesTxt))
+		}
+		tests.CheckNotErrorf(t, ExecExtSort(ctx, cfg), "paths %v", paths)
+
+		if cfg.OutputFilePath == StdioFilePath {
+			tests.CheckExpectedf(t, expected, out.String(), "paths %v", paths)
+		} else {
+			tests.CheckExpectedf(t, expected, tools.ReadFile(t, cfg.OutputFilePath), "paths %v", paths)
+			tests.CheckExpected(t, 0, out.Len())
+		}
+
+		tools.CheckReleased(t)
+		tests.CheckNotError(t, tools.CheckAbsent(cfg.TempDir+"/left_000001"))
+	}
+
+	_, cfg := newExtSortTools(t)
+	cfg.InputFilePath, cfg.OutputFilePath = StdioFilePath, StdioFilePath
+	cfg.TempDir = "."
+	tests.CheckNotError(t, cfg.Check())
+	cfg.InputFilePath, cfg.OutputFilePath = "output", "output"
+	tests.CheckErrorIs(t, ErrBadConfig, cfg.Check())
+}
+
+func Test_ExtSort_MultipleInputs(t *testing.T) {
+	tools, cfg := newExtSortTools(t)
+	cfg.InputFilePaths = []string{"input_1", "input_2", "input_3"}
+	cfg.ChunkCapacity = 16
+	cfg.PreferredChunkSize = 64
+	cfg.WorkersCount = 2
+	cfg.RecordFormat = RecordFormat{Header: true}
+	cfg.Keys, _ = ParseKeys("[k]n")
+	cfg.Stable = true
+
+	expected := make([]string, 0)
+	for i, filePath := range cfg.GetInputFilePaths() {
+		lines := []string{"k v"}
+		for j := 0; j < 100; j++ {
+			lines = append(lines, fmt.Sprintf("%v %v_%v", (100-j)%10, filePath, j))
+		}
+		expected = append(expected, lines[1:]...)
+		data := strings.Join(lines, "\n")
+		if i != 2 { // the missing terminator of a not last input does not glue records
+			data += "\n"
+		}
+		tests.CheckNotError(t, tools.CreateFile(filePath, data))
+	}
+	sort.SliceStable(expected, func(i, j int) bool { return expected[i][0] < expected[j][0] })
+
+	tests.CheckNotError(t, ExecExtSort(tools.Ctx, cfg))
+
+	tests.CheckExpected(t, "k v\n"+strings.Join(expected, "\n")+"\n", tools.ReadFile(t, cfg.OutputFilePath))
+
+	tools.CheckReleased(t)
+	tests.CheckNotError(t, tools.CheckAbsent(cfg.TempDir+"/chunk_000001_000001"))
+
+	tests.CheckNotError(t, tools.CreateFile("input_4", "key v\n1 a\n"))
+	cfg.InputFilePaths = append(cfg.InputFilePaths, "input_4")
+	tests.CheckErrorIs(t, ErrBadRecord, ExecExtSort(tools.Ctx, cfg))
+	tests.CheckExpected(t, false, tools.Fs.HasOpenedEntries())
+
+	cfg.InputFilePaths = []string{"input_1", "missing"}
+	tests.CheckErrorIs(t, os.ErrNotExist, ExecExtSort(tools.Ctx, cfg))
+
+	cfg.InputFilePaths = []string{"input_1", cfg.OutputFilePath}
+	tests.CheckErrorIs(t, ErrBadConfig, cfg.Check())
+
+	cfg.InputFilePath, cfg.InputFilePaths = StdioFilePath, []string{StdioFilePath}
+	tests.CheckErrorIs(t, ErrBadConfig, cfg.Check())
+
+	cfg.InputFilePath, cfg.InputFilePaths = "", nil
+	tests.CheckErrorIs(t, ErrBadConfig, cfg.Check())
+}
+
+func Test_ExtSort_MergeOnly(t *testing.T) {
+	tools, cfg := newExtSortTools(t)
+	cfg.InputFilePaths = []string{"input_1", "input_2"}
+	cfg.ChunkCapacity = 16
+	cfg.PreferredChunkSize = 64
+	cfg.MergeOnly = true
+	cfg.CheckSorted = true
+	cfg.Unique = true
+
+	tests.CheckNotError(t, tools.CreateFile("input", "a\nc\nc\ne\n"))
+	tests.CheckNotError(t, tools.CreateFile("input_1", "b\nd\n"))
+	tests.CheckNotError(t, tools.CreateFile("input_2", "a\nf"))
+	tests.CheckNotError(t, ExecExtSort(tools.Ctx, cfg))
+
+	tests.CheckExpected(t, "a\nb\nc\nd\ne\nf\n", tools.ReadFile(t, cfg.OutputFilePath))
+	tests.CheckNotError(t, tools.CheckFileSize("input_1", 4))
+
+	tools.CheckReleased(t)
+
+	tests.CheckNotError(t, tools.CreateFile("input_3", "x\ny\nb\nz\n"))
+	cfg.InputFilePaths = []string{"input_1", "input_3"}
+	cfg.OutputFilePath = "output_2"
+	err := ExecExtSort(tools.Ctx, cfg)
+	tests.CheckErrorIs(t, ErrNotSorted, err)
+	tests.CheckExpected(t, true, strings.Contains(err.Error(), "'input_3' line 3"))
+	tests.CheckNotError(t, tools.CheckAbsent(cfg.TempDir+"/chunk_000002_000001"))
+	tests.CheckNotError(t, tools.CheckAbsent(cfg.OutputFilePath))
 	tests.CheckExpected(t, false, tools.Fs.HasOpenedEntries())
+
+	cfg.CheckSorted = false
+	tests.CheckNotError(t, ExecExtSort(tools.Ctx, cfg))
+	tests.CheckNotError(t, tools.CheckFileSize(cfg.OutputFilePath, 18))
+
+	tools.CheckReleased(t)
+
+	cfg.MergeOnly = false
+	cfg.CheckSorted = true
+	tests.CheckErrorIs(t, ErrBadConfig, cfg.Check())
+}
+
+func Test_ExtSort_MergeOnlyFormat(t *testing.T) {
+	tools, cfg := newExtSortTools(t)
+	cfg.InputFilePaths = []string{"input_1.gz", "input_2"}
+	cfg.RecordFormat = RecordFormat{Header: true, KeepMissingTerminator: true}
+	cfg.Keys, _ = ParseKeys("[n]n")
+	cfg.MergeOnly = true
+	cfg.CheckSorted = true
+
+	tests.CheckNotError(t, tools.CreateFile("input", "x n\nb 2\nd 10"))
+	tests.CheckNotError(t, tools.CreateFile("input_1.gz", gzipString(t, "x n\na 1\nc 3\n")))
+	tests.CheckNotError(t, tools.CreateFile("input_2", "x n\ne 20"))
+	tests.CheckNotError(t, ExecExtSort(tools.Ctx, cfg))
+	tests.CheckExpected(t, "x n\na 1\nb 2\nc 3\nd 10\ne 20", tools.ReadFile(t, cfg.OutputFilePath))
+
+	tests.CheckNotError(t, tools.CreateFile("input_3", "y n\nf 30\n"))
+	cfg.InputFilePaths = []string{"input_3"}
+	cfg.OutputFilePath = "output_2"
+	tests.CheckErrorIs(t, ErrBadRecord, ExecExtSort(tools.Ctx, cfg))
+	tests.CheckNotError(t, tools.CheckAbsent(cfg.OutputFilePath))
+
+	tools.CheckReleased(t)
+}
+
+func Test_ExtSort_CSV(t *testing.T) {
+	tools, cfg := newExtSortTools(t)
+
+	linesArr := make([]string, 0, 2000)
+	for i := 0; i < 2000; i++ {
+		linesArr = append(linesArr, fmt.Sprintf("\"name, %v\",\"multi\nline\",%v", i, 2000-i))
+	}
+	header := "name,comment,\"unit price\""
+	linesTxt := header + "\r\n" + strings.Join(linesArr, "\r\n")
+	tests.CheckNotError(t, tools.CreateFile(cfg.InputFilePath, linesTxt))
+
+	cfg.WorkerWriteBufSize = 1024
+	cfg.WorkerReadBufSize = 1024
+	cfg.ChunkCapacity = 1024
+	cfg.PreferredChunkSize = 1024
+	cfg.RecordFormat = RecordFormat{CSV: true, CRLF: true, Header: true, KeepMissingTerminator: true}
+	cfg.Keys, _ = ParseKeys("[unit price]n")
+	tests.CheckNotError(t, ExecExtSort(tools.Ctx, cfg))
+	tests.CheckNotError(t, tools.CheckFileSize(cfg.OutputFilePath, uint64(len(linesTxt))))
+
+	mergedData := tools.ReadFile(t, cfg.OutputFilePath)
+
+	for i, j := 0, len(linesArr)-1; i < j; i, j = i+1, j-1 {
+		linesArr[i], linesArr[j] = linesArr[j], linesArr[i]
+	}
+	tests.CheckExpected(t, header+"\r\n"+strings.Join(linesArr, "\r\n"), mergedData)
+
+	tools.CheckReleased(t)
+
+	cfg.Keys, _ = ParseKeys("[price]n")
+	tests.CheckErrorIs(t, ErrBadConfig, ExecExtSort(tools.Ctx, cfg))
+	tests.CheckExpected(t, false, tools.Fs.HasOpenedEntries())
+}
+
+func Test_ExtSort_JSONKey(t *testing.T) {
+	tools, cfg := newExtSortTools(t)
+
+	linesArr := make([]string, 0, 2000)
+	for i := 0; i < 2000; i++ {
+		linesArr = append(linesArr, fmt.Sprintf(`{"seq": %v, "user": {"id": %v}}`, i, 2000-i))
+	}
+	missing := []string{`{"user": {}}`, `not json`}
+	linesTxt := strings.Join(append(append([]string(nil), missing...), linesArr...), "\n") + "\n"
+	tests.CheckNotError(t, tools.CreateFile(cfg.InputFilePath, linesTxt))
+
+	cfg.WorkerWriteBufSize = 1024
+	cfg.WorkerReadBufSize = 1024
+	cfg.ChunkCapacity = 1024
+	cfg.PreferredChunkSize = 1024
+	cfg.JSONKey = JSONKey{Path: ".user.id", Type: JSONKeyTypeNumber, Missing: JSONMissingLast}
+	tests.CheckNotError(t, ExecExtSort(tools.Ctx, cfg))
+
+	mergedData := tools.ReadFile(t, cfg.OutputFilePath)
+
+	for i, j := 0, len(linesArr)-1; i < j; i, j = i+1, j-1 {
+		linesArr[i], linesArr[j] = linesArr[j], linesArr[i]
+	}
+	sort.Strings(missing)
+	expected := strings.Join(append(linesArr, missing...), "\n") + "\n"
+	tests.CheckExpected(t, expected, mergedData)
+
+	tools.CheckReleased(t)
+
+	tests.CheckNotError(t, tools.Fs.Remove(cfg.OutputFilePath))
+	cfg.JSONKey.Missing = JSONMissingError
+	tests.CheckErrorIs(t, ErrBadRecord, ExecExtSort(tools.Ctx, cfg))
+	tests.CheckNotError(t, tools.CheckAbsent(cfg.OutputFilePath))
+	tests.CheckExpected(t, false, tools.Fs.HasOpenedEntries())
+}
+
+func Test_ExtSort_FixedSize(t *testing.T) {
+	tools, cfg := newExtSortTools(t)
+
+	records := make([]string, 0, 2000)
+	for i := 0; i < 2000; i++ {
+		key := fmt.Sprintf("%010v", (i*7919)%2000)
+		records = append(records, key+"\r\n"+strings.Repeat("\x00", 86)+"\r\n")
+	}
+	tests.CheckNotError(t, tools.CreateFile(cfg.InputFilePath, strings.Join(records, "")))
+
+	cfg.WorkerWriteBufSize = 1024
+	cfg.WorkerReadBufSize = 1024
+	cfg.ChunkCapacity = 1024
+	cfg.PreferredChunkSize = 10 * 1024
+	cfg.RecordFormat.FixedSize = 100
+	cfg.BinaryKey = BinaryKey{Length: 10}
+	tests.CheckNotError(t, ExecExtSort(tools.Ctx, cfg))
+
+	mergedData := tools.ReadFile(t, cfg.OutputFilePath)
+
+	sort.Strings(records)
+	tests.CheckExpected(t, strings.Join(records, ""), mergedData)
+
+	tools.CheckReleased(t)
+}
+
+func Test_ExtSort_Uint64(t *testing.T) {
+	tools, cfg := newExtSortTools(t)
+
+	values := make([]uint64, 0, 5000)
+	data := make([]byte, 0, 5000*8)
+	for i := 0; i < 5000; i++ {
+		val := uint64(i) * 0x9E3779B97F4A7C15
+		values = append(values, val)
+		data = binary.LittleEndian.AppendUint64(data, val)
+	}
+	tests.CheckNotError(t, tools.CreateFile(cfg.InputFilePath, string(data)))
+
+	cfg.WorkerWriteBufSize = 1024
+	cfg.WorkerReadBufSize = 1024
+	cfg.ChunkCapacity = 1024
+	cfg.PreferredChunkSize = 1024
+	cfg.RecordFormat.FixedSize = 8
+	cfg.BinaryKey = BinaryKey{Type: BinaryKeyUint64LE}
+	cfg.Reverse = true
+	tests.CheckNotError(t, ExecExtSort(tools.Ctx, cfg))
+	tests.CheckNotError(t, tools.CheckFileSize(cfg.OutputFilePath, uint64(len(data))))
+
+	mergedData := []byte(tools.ReadFile(t, cfg.OutputFilePath))
+
+	sort.Slice(values, func(i, j int) bool { return values[i] > values[j] })
+	for i, val := range values {
+		tests.CheckExpected(t, val, binary.LittleEndian.Uint64(mergedData[i*8:]))
+	}
+
+	tools.CheckReleased(t)
+}
+
+func Test_ExtSort_LengthPrefixed(t *testing.T) {
+	tools, cfg := newExtSortTools(t)
+
+	format := RecordFormat{LengthPrefix: LengthPrefixVarint}
+
+	records := make([]string, 0, 2000)
+	input := &strings.Builder{}
+	writer := format.Framing().NewWriter(input)
+	for i := 0; i < 2000; i++ {
+		record := string(binary.BigEndian.AppendUint32(nil, uint32(2000-i))) + "\n\x00" + strings.Repeat("\xff", i%200)
+		records = append(records, record)
+		_, err := writer.WriteRecord(record)
+		tests.CheckNotError(t, err)
+	}
+	tests.CheckNotError(t, tools.CreateFile(cfg.InputFilePath, input.String()))
+
+	cfg.WorkerWriteBufSize = 1024
+	cfg.WorkerReadBufSize = 1024
+	cfg.ChunkCapacity = 1024
+	cfg.PreferredChunkSize = 10 * 1024
+	cfg.RecordFormat = format
+	cfg.ExtractKey = func(record string) string { return record[:4] }
+	tests.CheckNotError(t, ExecExtSort(tools.Ctx, cfg))
+	tests.CheckNotError(t, tools.CheckFileSize(cfg.OutputFilePath, uint64(input.Len())))
+
+	merged := strings.NewReader(tools.ReadFile(t, cfg.OutputFilePath))
+	mergedRecords, err := CollectLines(NewSyncRecordsGenFromReader(tools.Ctx, merged, format))
+	tests.CheckNotError(t, err)
+
+	sort.Strings(records)
+	tests.CheckExpected(t, strings.Join(records, "|"), strings.Join(mergedRecords, "|"))
+
+	tools.CheckReleased(t)
 }
 
 func Test_ExtSort_Cancel_1(t *testing.T) {
@@ -110,8 +766,7 @@ func Test_ExtSort_Cancel_1(t *testing.T) {
 	cfg.ChunkCapacity = 1024
 	cfg.PreferredChunkSize = 1024
 	tests.CheckErrorIs(t, context.Canceled, ExecExtSort(ctx, cfg))
-	tests.CheckExpected(t, 0, len(tools.UnhandledErrs()))
-	tests.CheckExpected(t, false, tools.Fs.HasOpenedEntries())
+	tools.CheckReleased(t)
 }
 
 func Test_ExtSort_Cancel_2(t *testing.T) {
@@ -152,8 +807,7 @@ func Test_ExtSort_Cancel_2(t *testing.T) {
 	cfg.ChunkCapacity = 1024
 	cfg.PreferredChunkSize = 1024
 	tests.CheckErrorIs(t, context.Canceled, ExecExtSort(ctx, cfg))
-	tests.CheckExpected(t, 0, len(tools.UnhandledErrs()))
-	tests.CheckExpected(t, false, tools.Fs.HasOpenedEntries())
+	tools.CheckReleased(t)
 }
 
 func Test_ExtSort_Timeout_1(t *testing.T) {
@@ -192,8 +846,7 @@ func Test_ExtSort_Timeout_1(t *testing.T) {
 	cfg.ChunkCapacity = 1024
 	cfg.PreferredChunkSize = 1024
 	tests.CheckErrorIs(t, context.DeadlineExceeded, ExecExtSort(ctx, cfg))
-	tests.CheckExpected(t, 0, len(tools.UnhandledErrs()))
-	tests.CheckExpected(t, false, tools.Fs.HasOpenedEntries())
+	tools.CheckReleased(t)
 }
 
 func Test_ExtSort_Timeout_2(t *testing.T) {
@@ -232,8 +885,7 @@ func Test_ExtSort_Timeout_2(t *testing.T) {
 	cfg.ChunkCapacity = 1024
 	cfg.PreferredChunkSize = 1024
 	tests.CheckErrorIs(t, context.DeadlineExceeded, ExecExtSort(ctx, cfg))
-	tests.CheckExpected(t, 0, len(tools.UnhandledErrs()))
-	tests.CheckExpected(t, false, tools.Fs.HasOpenedEntries())
+	tools.CheckReleased(t)
 }
 
 func newExtSortTools(t *testing.T) (*TestTools, Config) {
@@ -0,0 +1,88 @@
+package extsort
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	FlagKey                   = "key"
+	FlagFieldSeparator        = "field_separator"
+	FlagReverse               = "reverse"
+	FlagUnique                = "unique"
+	FlagStable                = "stable"
+	FlagCompareMode           = "compare"
+	FlagZeroTerminated        = "zero_terminated"
+	FlagMaxRecordSize         = "max_record_size_kb"
+	FlagCRLF                  = "crlf"
+	FlagKeepMissingTerminator = "keep_missing_terminator"
+	FlagCSV                   = "csv"
+	FlagHeader                = "header"
+	FlagJSONKey               = "json_key"
+	FlagJSONKeyType           = "json_key_type"
+	FlagJSONMissing           = "json_missing"
+	FlagFixedRecordSize       = "fixed_record_size"
+	FlagLengthPrefix          = "length_prefix"
+	FlagBinaryKeyOffset       = "binary_key_offset"
+	FlagBinaryKeyLength       = "binary_key_length"
+	FlagBinaryKeyType         = "binary_key_type"
+)
+
+func BindOrderFlags(flagSet *flag.FlagSet, cfg *Config) {
+	flagSet.StringVar(&cfg.FieldSeparator, FlagFieldSeparator, cfg.FieldSeparator, "fields separator (blank to non-blank transition if empty)")
+	flagSet.BoolVar(&cfg.Reverse, FlagReverse, cfg.Reverse, "sort in descending order")
+	flagSet.BoolVar(&cfg.Unique, FlagUnique, cfg.Unique, "output only the first of equal lines")
+	flagSet.BoolVar(&cfg.Stable, FlagStable, cfg.Stable, "keep the input order of lines with equal keys")
+	flagSet.Func(FlagCompareMode, fmt.Sprintf("compare mode: %v (default %v)", strings.Join(CompareModeNames(), "|"), cfg.CompareMode), func(name string) error {
+		mode, err := ParseCompareMode(name)
+		cfg.CompareMode = mode
+		return err
+	})
+	flagSet.Func(FlagKey, "sort keys 'F[.C][OPTS][,F[.C][OPTS]] ...', F is a number or a header column name in brackets, OPTS: b - ignore leading blanks, d - dictionary order, f - fold case, i - ignore non-printing, n|g|h|V - compare mode, r - reverse (can be repeated)", func(spec string) error {
+		keys, err := ParseKeys(spec)
+		if err != nil {
+			return err
+		}
+		cfg.Keys = append(cfg.Keys, keys...)
+		return nil
+	})
+	flagSet.StringVar(&cfg.JSONKey.Path, FlagJSONKey, cfg.JSONKey.Path, "JSON Lines field path of the sort key, e.g. '.user.id'")
+	flagSet.Func(FlagJSONKeyType, fmt.Sprintf("JSON key type: %v (default %v)", strings.Join(JSONKeyTypeNames(), "|"), cfg.JSONKey.Type), func(name string) error {
+		keyType, err := ParseJSONKeyType(name)
+		cfg.JSONKey.Type = keyType
+		return err
+	})
+	flagSet.Func(FlagJSONMissing, fmt.Sprintf("placement of JSON records without the key or malformed: %v (default %v)", strings.Join(JSONMissingPolicyNames(), "|"), cfg.JSONKey.Missing), func(name string) error {
+		policy, err := ParseJSONMissingPolicy(name)
+		cfg.JSONKey.Missing = policy
+		return err
+	})
+	flagSet.IntVar(&cfg.BinaryKey.Offset, FlagBinaryKeyOffset, cfg.BinaryKey.Offset, "key offset in fixed size records")
+	flagSet.IntVar(&cfg.BinaryKey.Length, FlagBinaryKeyLength, cfg.BinaryKey.Length, "key length in fixed size records, up to the end of the record if 0")
+	flagSet.Func(FlagBinaryKeyType, fmt.Sprintf("key type of fixed size records: %v (default %v)", strings.Join(BinaryKeyTypeNames(), "|"), cfg.BinaryKey.Type), func(name string) error {
+		keyType, err := ParseBinaryKeyType(name)
+		cfg.BinaryKey.Type = keyType
+		return err
+	})
+}
+
+func BindRecordFormatFlags(flagSet *flag.FlagSet, format *RecordFormat) {
+	flagSet.BoolVar(&format.ZeroTerminated, FlagZeroTerminated, format.ZeroTerminated, "records are terminated by '\\0' instead of '\\n'")
+	flagSet.BoolVar(&format.CRLF, FlagCRLF, format.CRLF, "records are terminated by '\\r\\n', a bare '\\n' is accepted too")
+	flagSet.BoolVar(&format.KeepMissingTerminator, FlagKeepMissingTerminator, format.KeepMissingTerminator, "do not add the terminator to the output if the input ends without it")
+	flagSet.BoolVar(&format.CSV, FlagCSV, format.CSV, "records are RFC 4180 CSV, keys refer to unquoted fields, the field separator is ',' by default")
+	flagSet.BoolVar(&format.Header, FlagHeader, format.Header, "the first record is a header kept at the top of the output")
+	flagSet.IntVar(&format.FixedSize, FlagFixedRecordSize, format.FixedSize, "size of binary records without terminators, e.g. 100 for TeraSort records")
+	flagSet.Func(FlagLengthPrefix, fmt.Sprintf("binary records are prefixed by their length: %v (default %v)", strings.Join(LengthPrefixNames(), "|"), format.LengthPrefix), func(name string) error {
+		prefix, err := ParseLengthPrefix(name)
+		format.LengthPrefix = prefix
+		return err
+	})
+	flagSet.Func(FlagMaxRecordSize, "max record size, unlimited if 0 (default 0)", func(value string) error {
+		sizeKb, err := strconv.Atoi(value)
+		format.MaxRecordSize = sizeKb * 1024
+		return err
+	})
+}
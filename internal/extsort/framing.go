@@ -0,0 +1,340 @@
+package extsort
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// RecordReader reads framed records one by one, it returns io.EOF after the last record.
+type RecordReader interface {
+	ReadRecord() (string, error)
+}
+
+// RecordWriter writes records with their framing, it returns the number of serialized bytes.
+type RecordWriter interface {
+	WriteRecord(record string) (int, error)
+}
+
+// RecordFraming is the way records are serialized in files. Splitting and merging work
+// with records only through it, so a new framing does not affect them.
+type RecordFraming interface {
+	NewReader(r io.Reader) RecordReader
+	NewWriter(w io.Writer) RecordWriter
+	SerializedSize(record string) int
+}
+
+// Framing returns the framing described by the format, CSV fields are separated by commas.
+func (this RecordFormat) Framing() RecordFraming {
+	return this.framing(',')
+}
+
+func (this RecordFormat) framing(comma byte) RecordFraming {
+	if this.FixedSize > 0 {
+		return fixedSizeFraming{size: this.FixedSize}
+	}
+
+	if this.LengthPrefix != LengthPrefixNone {
+		return lengthPrefixedFraming{prefix: this.LengthPrefix, maxSize: this.MaxRecordSize}
+	}
+
+	return textFraming{
+		terminator: this.Terminator(),
+		crlf:       this.CRLF,
+		csv:        this.CSV,
+		comma:      comma,
+		maxSize:    this.MaxRecordSize,
+	}
+}
+
+func FramingOrDefault(framing RecordFraming) RecordFraming {
+	if framing == nil {
+		return RecordFormat{}.Framing()
+	}
+	return framing
+}
+
+func EnumRecords(ctx context.Context, reader RecordReader, consume func(record string) error) (int, error) {
+	recordsCount := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return recordsCount, err
+		}
+
+		record, err := reader.ReadRecord()
+		if errors.Is(err, io.EOF) {
+			return recordsCount, nil
+		}
+		if err != nil {
+			return recordsCount, err
+		}
+
+		recordsCount++
+		if err = consume(record); err != nil {
+			return recordsCount, err
+		}
+	}
+}
+
+func asBufReader(r io.Reader) *bufio.Reader {
+	if bufReader, ok := r.(*bufio.Reader); ok {
+		return bufReader
+	}
+	return bufio.NewReader(r)
+}
+
+func checkWrittenBytes(written, expected int, err error) (int, error) {
+	if err == nil && written != expected {
+		err = ErrUnexpectedWrittenBytesCount
+	}
+	return written, err
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// textFraming reads records of any length unless maxSize limits it. With crlf the '\r' is removed
+// only if it is followed by '\n'. With csv a terminator inside a quoted field is a part of the record.
+type textFraming struct {
+	terminator byte
+	crlf       bool
+	csv        bool
+	comma      byte
+	maxSize    int
+}
+
+func (this textFraming) NewReader(r io.Reader) RecordReader {
+	return &textRecordReader{framing: this, reader: asBufReader(r), csv: csvScanner{comma: this.comma, crlf: this.crlf}}
+}
+
+func (this textFraming) NewWriter(w io.Writer) RecordWriter {
+	return &textRecordWriter{writer: w, terminator: this.serializedTerminator()}
+}
+
+func (this textFraming) SerializedSize(record string) int {
+	return len(record) + len(this.serializedTerminator())
+}
+
+func (this textFraming) serializedTerminator() string {
+	if this.crlf {
+		return "\r\n"
+	}
+	return string(this.terminator)
+}
+
+type textRecordReader struct {
+	framing      textFraming
+	reader       *bufio.Reader
+	buf          []byte
+	csv          csvScanner
+	recordsCount int
+}
+
+func (this *textRecordReader) ReadRecord() (string, error) {
+	this.buf = this.buf[:0]
+	this.csv.reset()
+	for {
+		data, err := this.reader.ReadSlice(this.framing.terminator)
+
+		inQuotes := false
+		if this.framing.csv {
+			terminated := err == nil
+			if e := this.csv.scan(data, terminated); e != nil {
+				return "", fmt.Errorf("%w: record #%v %v", ErrBadRecord, this.recordsCount+1, e)
+			}
+			inQuotes = this.csv.inQuotes()
+		}
+
+		if err == nil && !inQuotes {
+			data = data[:len(data)-1]
+			if this.framing.crlf {
+				if len(data) > 0 {
+					data = bytes.TrimSuffix(data, []byte{'\r'})
+				} else {
+					this.buf = bytes.TrimSuffix(this.buf, []byte{'\r'})
+				}
+			}
+			if err = this.checkSize(len(this.buf) + len(data)); err != nil {
+				return "", err
+			}
+			this.recordsCount++
+			if len(this.buf) == 0 {
+				return string(data), nil
+			}
+			return string(append(this.buf, data...)), nil
+		}
+
+		this.buf = append(this.buf, data...)
+		if e := this.checkSize(len(this.buf)); e != nil {
+			return "", e
+		}
+
+		if err == nil || errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+
+		if errors.Is(err, io.EOF) && len(this.buf) > 0 {
+			if inQuotes {
+				return "", fmt.Errorf("%w: record #%v has unterminated quoted field", ErrBadRecord, this.recordsCount+1)
+			}
+			this.recordsCount++
+			return string(this.buf), nil
+		}
+
+		return "", err
+	}
+}
+
+func (this *textRecordReader) checkSize(size int) error {
+	if this.framing.maxSize > 0 && size > this.framing.maxSize {
+		return fmt.Errorf("%w: record #%v is longer than %v bytes", ErrRecordTooLong, this.recordsCount+1, this.framing.maxSize)
+	}
+	return nil
+}
+
+type textRecordWriter struct {
+	writer     io.Writer
+	terminator string
+}
+
+func (this *textRecordWriter) WriteRecord(record string) (int, error) {
+	n, err := io.WriteString(this.writer, record)
+	if err == nil {
+		var n2 int
+		n2, err = io.WriteString(this.writer, this.terminator)
+		n += n2
+	}
+	return checkWrittenBytes(n, len(record)+len(this.terminator), err)
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+type fixedSizeFraming struct {
+	size int
+}
+
+func (this fixedSizeFraming) NewReader(r io.Reader) RecordReader {
+	return &fixedSizeRecordReader{reader: asBufReader(r), buf: make([]byte, this.size)}
+}
+
+func (this fixedSizeFraming) NewWriter(w io.Writer) RecordWriter {
+	return &fixedSizeRecordWriter{writer: w, size: this.size}
+}
+
+func (this fixedSizeFraming) SerializedSize(record string) int {
+	return len(record)
+}
+
+type fixedSizeRecordReader struct {
+	reader       io.Reader
+	buf          []byte
+	recordsCount int
+}
+
+func (this *fixedSizeRecordReader) ReadRecord() (string, error) {
+	n, err := io.ReadFull(this.reader, this.buf)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", fmt.Errorf("%w: record #%v has %v of %v bytes", ErrBadRecord, this.recordsCount+1, n, len(this.buf))
+	}
+	if err != nil {
+		return "", err
+	}
+	this.recordsCount++
+	return string(this.buf), nil
+}
+
+type fixedSizeRecordWriter struct {
+	writer io.Writer
+	size   int
+}
+
+func (this *fixedSizeRecordWriter) WriteRecord(record string) (int, error) {
+	if len(record) != this.size {
+		return 0, fmt.Errorf("%w: record has %v of %v bytes", ErrBadRecord, len(record), this.size)
+	}
+	n, err := io.WriteString(this.writer, record)
+	return checkWrittenBytes(n, len(record), err)
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+type lengthPrefixedFraming struct {
+	prefix  LengthPrefix
+	maxSize int
+}
+
+func (this lengthPrefixedFraming) NewReader(r io.Reader) RecordReader {
+	return &lengthPrefixedRecordReader{framing: this, reader: asBufReader(r)}
+}
+
+func (this lengthPrefixedFraming) NewWriter(w io.Writer) RecordWriter {
+	return &lengthPrefixedRecordWriter{framing: this, writer: w}
+}
+
+func (this lengthPrefixedFraming) SerializedSize(record string) int {
+	return lengthPrefixes[this.prefix].size(uint64(len(record))) + len(record)
+}
+
+type lengthPrefixedRecordReader struct {
+	framing      lengthPrefixedFraming
+	reader       *bufio.Reader
+	buf          bytes.Buffer
+	recordsCount int
+}
+
+func (this *lengthPrefixedRecordReader) ReadRecord() (string, error) {
+	size, err := lengthPrefixes[this.framing.prefix].read(this.reader)
+	if errors.Is(err, io.EOF) {
+		return "", err
+	}
+	if err != nil { // e.g. truncated or overflowing varint
+		return "", fmt.Errorf("%w: record #%v has bad length prefix: %w", ErrBadRecord, this.recordsCount+1, err)
+	}
+
+	maxSize := uint64(this.framing.maxSize)
+	if maxSize > 0 && size > maxSize {
+		return "", fmt.Errorf("%w: record #%v is longer than %v bytes", ErrRecordTooLong, this.recordsCount+1, maxSize)
+	}
+
+	if size > math.MaxInt {
+		return "", fmt.Errorf("%w: record #%v has bad length prefix %v", ErrBadRecord, this.recordsCount+1, size)
+	}
+
+	// the buffer grows with the data read, so a corrupt prefix does not allocate its size at once
+	this.buf.Reset()
+	n, err := io.CopyN(&this.buf, this.reader, int64(size))
+	if errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("%w: record #%v has %v of %v bytes", ErrBadRecord, this.recordsCount+1, n, size)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	this.recordsCount++
+	return this.buf.String(), nil
+}
+
+type lengthPrefixedRecordWriter struct {
+	framing lengthPrefixedFraming
+	writer  io.Writer
+	buf     [binary.MaxVarintLen64]byte
+}
+
+func (this *lengthPrefixedRecordWriter) WriteRecord(record string) (int, error) {
+	if this.framing.prefix != LengthPrefixVarint && uint64(len(record)) > math.MaxUint32 {
+		return 0, fmt.Errorf("%w: %v bytes record does not fit %v prefix", ErrRecordTooLong, len(record), this.framing.prefix)
+	}
+
+	prefix := lengthPrefixes[this.framing.prefix].append(this.buf[:0], uint64(len(record)))
+	n, err := this.writer.Write(prefix)
+	if err == nil {
+		var n2 int
+		n2, err = io.WriteString(this.writer, record)
+		n += n2
+	}
+	return checkWrittenBytes(n, len(prefix)+len(record), err)
+}
@@ -0,0 +1,78 @@
+package extsort
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// newDecompressingReader decompresses the source if it is gzipped, gzip is detected by the magic bytes
+// or by the ".gz" extension of the name. The returned reader closes the source.
+func newDecompressingReader(source io.ReadCloser, name string, bufSize int) (io.ReadCloser, error) {
+	reader := bufio.NewReaderSize(source, bufSize)
+
+	magic, err := reader.Peek(len(gzipMagic))
+	if errors.Is(err, io.EOF) { // too short to be gzipped
+		return &readCloser{Reader: reader, close: source.Close}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(magic, gzipMagic) && !strings.EqualFold(filepath.Ext(name), ".gz") {
+		return &readCloser{Reader: reader, close: source.Close}, nil
+	}
+
+	gzipReader, err := gzip.NewReader(reader)
+	if err != nil {
+		return nil, fmt.Errorf("'%v': %w", name, err)
+	}
+
+	closeAll := func() error {
+		return errors.Join(gzipReader.Close(), source.Close())
+	}
+
+	return &readCloser{Reader: gzipReader, close: closeAll}, nil
+}
+
+type readCloser struct {
+	io.Reader
+	close func() error
+}
+
+func (this *readCloser) Close() error {
+	return this.close()
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// countingReader counts bytes read from the reader, the counter may be shared by several readers.
+type countingReader struct {
+	reader io.Reader
+	count  *atomic.Uint64
+}
+
+func (this *countingReader) Read(p []byte) (int, error) {
+	n, err := this.reader.Read(p)
+	this.count.Add(uint64(n))
+	return n, err
+}
+
+type countingWriter struct {
+	writer  io.Writer
+	written uint64
+}
+
+func (this *countingWriter) Write(p []byte) (int, error) {
+	n, err := this.writer.Write(p)
+	this.written += uint64(n)
+	return n, err
+}
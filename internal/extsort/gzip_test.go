@@ -0,0 +1,94 @@
+package extsort
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/kdpdev/extsort/internal/utils/tests"
+)
+
+func gzipString(t *testing.T, data string) string {
+	buf := &bytes.Buffer{}
+	writer := gzip.NewWriter(buf)
+	_, err := writer.Write([]byte(data))
+	tests.CheckNotError(t, err)
+	tests.CheckNotError(t, writer.Close())
+	return buf.String()
+}
+
+func gunzipString(t *testing.T, data string) string {
+	reader, err := gzip.NewReader(strings.NewReader(data))
+	tests.CheckNotError(t, err)
+	result, err := io.ReadAll(reader)
+	tests.CheckNotError(t, err)
+	return string(result)
+}
+
+func Test_ExtSort_Gzip(t *testing.T) {
+	linesArr := make([]string, 0, 2000)
+	for i := 0; i < 2000; i++ {
+		linesArr = append(linesArr, fmt.Sprintf("%05v", 2000-i))
+	}
+	linesTxt := strings.Join(linesArr, "\n") + "\n"
+	sort.Strings(linesArr)
+	expected := strings.Join(linesArr, "\n") + "\n"
+
+	for _, outputFilePath := range []string{"output", StdioFilePath} {
+		tools, cfg := newExtSortTools(t)
+		cfg.InputFilePaths = []string{"input_2.gz"}
+		cfg.OutputFilePath = outputFilePath
+		cfg.ChunkCapacity = 1024
+		cfg.PreferredChunkSize = 1024
+		cfg.GzipOutput = true
+		cfg.GzipLevel = gzip.BestSpeed
+
+		half := len(linesTxt) / 2
+		half += strings.IndexByte(linesTxt[half:], '\n') + 1
+		tests.CheckNotError(t, tools.CreateFile(cfg.InputFilePath, gzipString(t, linesTxt[:half]))) // detected by the magic
+		tests.CheckNotError(t, tools.CreateFile("input_2.gz", gzipString(t, linesTxt[half:])))
+
+		out := &bytes.Buffer{}
+		ctx := WithStdio(tools.Ctx, Stdio{Out: out})
+		tests.CheckNotError(t, ExecExtSort(ctx, cfg))
+
+		if outputFilePath == StdioFilePath {
+			tests.CheckExpected(t, expected, gunzipString(t, out.String()))
+		} else {
+			tests.CheckExpected(t, expected, gunzipString(t, tools.ReadFile(t, cfg.OutputFilePath)))
+		}
+
+		tools.CheckReleased(t)
+	}
+
+	_, cfg := newExtSortTools(t)
+	cfg.GzipOutput = true
+	cfg.GzipLevel = 10
+	tests.CheckErrorIs(t, ErrBadConfig, cfg.Check())
+}
+
+func Test_ExtSort_GzipFormat(t *testing.T) {
+	tools, cfg := newExtSortTools(t)
+	cfg.RecordFormat = RecordFormat{CRLF: true, Header: true, KeepMissingTerminator: true}
+	cfg.GzipOutput = true
+
+	tests.CheckNotError(t, tools.CreateFile(cfg.InputFilePath, gzipString(t, "h\r\nc\r\nb\r\na")))
+	tests.CheckNotError(t, ExecExtSort(tools.Ctx, cfg))
+	tests.CheckExpected(t, "h\r\na\r\nb\r\nc", gunzipString(t, tools.ReadFile(t, cfg.OutputFilePath)))
+
+	cfg.InputFilePath, cfg.OutputFilePath = "input.gz", "output_2"
+	tests.CheckNotError(t, tools.CreateFile(cfg.InputFilePath, "not gzipped"))
+	tests.CheckErrorIs(t, gzip.ErrHeader, ExecExtSort(tools.Ctx, cfg))
+	tests.CheckNotError(t, tools.CheckAbsent(cfg.OutputFilePath))
+
+	cfg.InputFilePath = "empty.gz"
+	tests.CheckNotError(t, tools.CreateFile(cfg.InputFilePath, ""))
+	tests.CheckNotError(t, ExecExtSort(tools.Ctx, cfg))
+	tests.CheckExpected(t, "", gunzipString(t, tools.ReadFile(t, cfg.OutputFilePath)))
+
+	tools.CheckReleased(t)
+}
@@ -0,0 +1,352 @@
+package extsort
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// JSONKey extracts the sort key of JSON Lines records by the field path like '.user.id'.
+// Records which are malformed, miss the field or have the value of another type
+// are placed according to the Missing policy. The last of duplicate fields is the key like
+// in encoding/json. The key is parsed once per record and records are validated only up to
+// the end of the objects holding the key, the JSONMissingError policy validates whole records.
+type JSONKey struct {
+	Path    string
+	Type    JSONKeyType
+	Missing JSONMissingPolicy
+}
+
+func (this JSONKey) IsEmpty() bool {
+	return this.Path == ""
+}
+
+func (this JSONKey) Check() error {
+	if _, err := parseJSONPath(this.Path); err != nil {
+		return err
+	}
+
+	if err := this.Type.Check(); err != nil {
+		return err
+	}
+
+	return this.Missing.Check()
+}
+
+// CheckRecord returns the ErrBadRecord error if the key can not be extracted from the record
+// and the Missing policy is JSONMissingError.
+func (this JSONKey) CheckRecord(record string) error {
+	if this.Missing != JSONMissingError {
+		return nil
+	}
+
+	path, err := parseJSONPath(this.Path)
+	if err != nil {
+		return err
+	}
+
+	if !json.Valid([]byte(record)) {
+		return fmt.Errorf("%w: malformed JSON", ErrBadRecord)
+	}
+
+	_, err = this.extract(record, path)
+	return err
+}
+
+// MakeCompare makes the compare of records by the key. The reverse order does not move
+// records without the key, they are placed according to the Missing policy.
+func (this JSONKey) MakeCompare(reverse bool) Compare {
+	return this.MakeRecordKey(reverse, nil).MakeCompare()
+}
+
+// MakeRecordKey makes the key which parses the value of the field once per record, records are ordered
+// like by MakeCompare and records with equal values are compared by the tie compare unless it is nil.
+func (this JSONKey) MakeRecordKey(reverse bool, tie Compare) RecordKey {
+	path, _ := parseJSONPath(this.Path)
+
+	missingOrder := 1
+	if this.Missing == JSONMissingLast {
+		missingOrder = -1
+	}
+
+	valuesOrder := 1
+	if reverse {
+		valuesOrder = -1
+	}
+
+	return RecordKey{
+		Extract: func(record string) any {
+			val, err := this.extract(record, path)
+			return jsonRecordKey{record: record, value: val, found: err == nil}
+		},
+		Compare: func(lhs, rhs any) int {
+			lhsKey, rhsKey := lhs.(jsonRecordKey), rhs.(jsonRecordKey)
+			result := missingOrder * compareBools(lhsKey.found, rhsKey.found)
+			if result == 0 && lhsKey.found {
+				result = valuesOrder * lhsKey.value.compare(rhsKey.value)
+			}
+			if result == 0 && tie != nil {
+				result = tie(lhsKey.record, rhsKey.record)
+			}
+			return result
+		},
+	}
+}
+
+func (this JSONKey) extract(record string, path []string) (jsonKeyValue, error) {
+	raw, err := lookupJSONField(record, path)
+	if err != nil {
+		return jsonKeyValue{}, err
+	}
+
+	val, ok := jsonKeyTypes[this.Type].parse(raw)
+	if !ok {
+		return jsonKeyValue{}, fmt.Errorf("%w: '%v' is not %v", ErrBadRecord, this.Path, this.Type)
+	}
+
+	return val, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+type JSONKeyType int
+
+const (
+	JSONKeyTypeString JSONKeyType = iota
+	JSONKeyTypeNumber
+	JSONKeyTypeTime // RFC 3339
+)
+
+var jsonKeyTypes = []struct {
+	name  string
+	parse func(raw string) (jsonKeyValue, bool)
+}{
+	JSONKeyTypeString: {"string", parseJSONStringKey},
+	JSONKeyTypeNumber: {"number", parseJSONNumberKey},
+	JSONKeyTypeTime:   {"time", parseJSONTimeKey},
+}
+
+func ParseJSONKeyType(name string) (JSONKeyType, error) {
+	for keyType, t := range jsonKeyTypes {
+		if t.name == name {
+			return JSONKeyType(keyType), nil
+		}
+	}
+	return JSONKeyTypeString, fmt.Errorf("%w: unknown JSON key type '%v'", ErrBadConfig, name)
+}
+
+func (this JSONKeyType) Check() error {
+	if this < 0 || int(this) >= len(jsonKeyTypes) {
+		return fmt.Errorf("%w: unknown JSON key type %d", ErrBadConfig, int(this))
+	}
+	return nil
+}
+
+func (this JSONKeyType) String() string {
+	if this.Check() != nil {
+		return fmt.Sprintf("JSONKeyType(%d)", int(this))
+	}
+	return jsonKeyTypes[this].name
+}
+
+func JSONKeyTypeNames() []string {
+	names := make([]string, 0, len(jsonKeyTypes))
+	for _, t := range jsonKeyTypes {
+		names = append(names, t.name)
+	}
+	return names
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+type JSONMissingPolicy int
+
+const (
+	JSONMissingFirst JSONMissingPolicy = iota
+	JSONMissingLast
+	JSONMissingError
+)
+
+var jsonMissingPolicies = []string{
+	JSONMissingFirst: "first",
+	JSONMissingLast:  "last",
+	JSONMissingError: "error",
+}
+
+func ParseJSONMissingPolicy(name string) (JSONMissingPolicy, error) {
+	for policy, policyName := range jsonMissingPolicies {
+		if policyName == name {
+			return JSONMissingPolicy(policy), nil
+		}
+	}
+	return JSONMissingFirst, fmt.Errorf("%w: unknown JSON missing policy '%v'", ErrBadConfig, name)
+}
+
+func (this JSONMissingPolicy) Check() error {
+	if this < 0 || int(this) >= len(jsonMissingPolicies) {
+		return fmt.Errorf("%w: unknown JSON missing policy %d", ErrBadConfig, int(this))
+	}
+	return nil
+}
+
+func (this JSONMissingPolicy) String() string {
+	if this.Check() != nil {
+		return fmt.Sprintf("JSONMissingPolicy(%d)", int(this))
+	}
+	return jsonMissingPolicies[this]
+}
+
+func JSONMissingPolicyNames() []string {
+	return append([]string(nil), jsonMissingPolicies...)
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+type jsonRecordKey struct {
+	record string
+	value  jsonKeyValue
+	found  bool
+}
+
+// jsonKeyValue holds one of the typed values, the others are zero.
+type jsonKeyValue struct {
+	str  string
+	num  float64
+	time time.Time
+}
+
+func (this jsonKeyValue) compare(other jsonKeyValue) int {
+	if result := strings.Compare(this.str, other.str); result != 0 {
+		return result
+	}
+	if this.num != other.num {
+		if this.num < other.num {
+			return -1
+		}
+		return 1
+	}
+	return this.time.Compare(other.time)
+}
+
+func parseJSONStringKey(raw string) (jsonKeyValue, bool) {
+	str, ok := unquoteJSONString(raw)
+	return jsonKeyValue{str: str}, ok
+}
+
+func parseJSONNumberKey(raw string) (jsonKeyValue, bool) {
+	if raw == "" || (raw[0] != '-' && !isDigit(raw[0])) {
+		return jsonKeyValue{}, false
+	}
+	num, err := strconv.ParseFloat(raw, 64)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		return jsonKeyValue{}, false
+	}
+	return jsonKeyValue{num: num}, true
+}
+
+func parseJSONTimeKey(raw string) (jsonKeyValue, bool) {
+	str, ok := unquoteJSONString(raw)
+	if !ok {
+		return jsonKeyValue{}, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, str)
+	if err != nil {
+		return jsonKeyValue{}, false
+	}
+	return jsonKeyValue{time: t}, true
+}
+
+func unquoteJSONString(raw string) (string, bool) {
+	if len(raw) < 2 || raw[0] != '"' {
+		return "", false
+	}
+	if strings.IndexByte(raw, '\\') < 0 {
+		return raw[1 : len(raw)-1], true
+	}
+	str := ""
+	err := json.Unmarshal([]byte(raw), &str)
+	return str, err == nil
+}
+
+func parseJSONPath(path string) ([]string, error) {
+	if !strings.HasPrefix(path, ".") {
+		return nil, fmt.Errorf("%w: JSON path '%v' must start with '.'", ErrBadConfig, path)
+	}
+	if path == "." {
+		return nil, nil
+	}
+	names := strings.Split(path[1:], ".")
+	for _, name := range names {
+		if name == "" {
+			return nil, fmt.Errorf("%w: JSON path '%v' has an empty field name", ErrBadConfig, path)
+		}
+	}
+	return names, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// lookupJSONField returns the raw value of the field reading tokens of the document by encoding/json.
+// Like encoding/json does, the last of duplicate fields is taken, so the objects holding the field
+// are read to their ends. The document is validated only up to the end of these objects.
+func lookupJSONField(doc string, path []string) (string, error) {
+	if len(path) == 0 {
+		raw := json.RawMessage{}
+		if err := json.NewDecoder(strings.NewReader(doc)).Decode(&raw); err != nil {
+			return "", malformedJSON(err)
+		}
+		return string(raw), nil
+	}
+
+	raw := doc
+	skipped := json.RawMessage{}
+	for _, name := range path {
+		decoder := json.NewDecoder(strings.NewReader(raw))
+
+		token, err := decoder.Token()
+		if err != nil {
+			return "", malformedJSON(err)
+		}
+		if token != json.Delim('{') {
+			return "", fmt.Errorf("%w: field '%v' is missing", ErrBadRecord, name)
+		}
+
+		found := false
+		for decoder.More() {
+			token, err = decoder.Token()
+			if err != nil {
+				return "", malformedJSON(err)
+			}
+
+			if token != name {
+				if err = decoder.Decode(&skipped); err != nil {
+					return "", malformedJSON(err)
+				}
+				continue
+			}
+
+			value := json.RawMessage{}
+			if err = decoder.Decode(&value); err != nil {
+				return "", malformedJSON(err)
+			}
+			raw, found = string(value), true
+		}
+
+		if _, err = decoder.Token(); err != nil {
+			return "", malformedJSON(err)
+		}
+
+		if !found {
+			return "", fmt.Errorf("%w: field '%v' is missing", ErrBadRecord, name)
+		}
+	}
+
+	return raw, nil
+}
+
+func malformedJSON(err error) error {
+	return fmt.Errorf("%w: malformed JSON: %v", ErrBadRecord, err)
+}
@@ -0,0 +1,133 @@
+package extsort
+
+import (
+	"testing"
+
+	"github.com/kdpdev/extsort/internal/utils/tests"
+)
+
+func Test_LookupJSONField(t *testing.T) {
+	doc := ` {"a": [1, {"b": "}"}], "user": {"name": "x\"y", "id": 42, "tags": []}, "ts": "2024-01-02T03:04:05Z"} `
+
+	cases := map[string]string{
+		".":          doc[1 : len(doc)-1],
+		".user.id":   "42",
+		".user.name": `"x\"y"`,
+		".user.tags": "[]",
+		".a":         `[1, {"b": "}"}]`,
+		".ts":        `"2024-01-02T03:04:05Z"`,
+	}
+
+	for path, expected := range cases {
+		names, err := parseJSONPath(path)
+		tests.CheckNotError(t, err)
+		raw, err := lookupJSONField(doc, names)
+		tests.CheckNotErrorf(t, err, "path '%v'", path)
+		tests.CheckExpectedf(t, expected, raw, "path '%v'", path)
+	}
+
+	for _, path := range []string{".b", ".user.ids", ".a.b", ".ts.x"} {
+		names, _ := parseJSONPath(path)
+		_, err := lookupJSONField(doc, names)
+		tests.CheckErrorIsf(t, ErrBadRecord, err, "path '%v'", path)
+	}
+
+	for _, doc := range []string{"", "{", `{"id" 1}`, `{"x": tru, "id": 1}`, `{"x": [1 2], "id": 1}`, `{"id": }`, `{"x": "`} {
+		_, err := lookupJSONField(doc, []string{"id"})
+		tests.CheckErrorIsf(t, ErrBadRecord, err, "doc '%v'", doc)
+	}
+
+	duplicates := []struct{ doc, path, expected string }{
+		{`{"id": 1, "x": 0, "id": 2}`, ".id", "2"},
+		{`{"id": 1, "id": {"id": 5}}`, ".id", `{"id": 5}`},
+		{`{"u": {"id": 1}, "u": {"id": 3, "id": 4}}`, ".u.id", "4"},
+	}
+	for _, c := range duplicates {
+		names, _ := parseJSONPath(c.path)
+		raw, err := lookupJSONField(c.doc, names)
+		tests.CheckNotErrorf(t, err, "doc '%v'", c.doc)
+		tests.CheckExpectedf(t, c.expected, raw, "doc '%v'", c.doc)
+	}
+
+	_, err := lookupJSONField(`{"u": {"id": 1}, "u": {}}`, []string{"u", "id"})
+	tests.CheckErrorIs(t, ErrBadRecord, err)
+
+	for _, path := range []string{"", "a", ".a..b", ".a."} {
+		tests.CheckErrorIs(t, ErrBadConfig, JSONKey{Path: path}.Check())
+	}
+}
+
+func Test_JSONKey_Compare(t *testing.T) {
+	key := JSONKey{Path: ".n", Type: JSONKeyTypeNumber}
+	checkCompareOrder(t, key.MakeCompare(false),
+		[]string{`{}`, `{"n": "1"}`, `not json`, `{"n": [1}`},
+		[]string{`{"n": -1.5}`},
+		[]string{`{"n": 2, "x": 1}`, `{"x": 1, "n": 2.0}`},
+		[]string{`{"n": 1e3}`},
+	)
+
+	key.Missing = JSONMissingLast
+	checkCompareOrder(t, key.MakeCompare(true),
+		[]string{`{"n": 1e3}`},
+		[]string{`{"n": 2}`},
+		[]string{`{"n": -1.5}`},
+		[]string{`{}`, `[]`},
+	)
+
+	key = JSONKey{Path: ".ts", Type: JSONKeyTypeTime}
+	checkCompareOrder(t, key.MakeCompare(false),
+		[]string{`{"ts": "yesterday"}`, `{"ts": 1}`},
+		[]string{`{"ts": "2024-01-02T03:04:05+01:00"}`},
+		[]string{`{"ts": "2024-01-02T03:04:05Z"}`, `{"ts": "2024-01-02T04:04:05+01:00"}`},
+		[]string{`{"ts": "2024-01-02T03:04:05.5Z"}`},
+	)
+
+	key = JSONKey{Path: ".user.name"}
+	checkCompareOrder(t, key.MakeCompare(false),
+		[]string{`{"user": null}`, `{"user": {"name": 1}}`},
+		[]string{`{"user": {"name": ""}}`},
+		[]string{`{"user": {"name": "a"}}`, `{"user": {"name": "a"}}`},
+		[]string{`{"user": {"name": "b"}}`},
+	)
+
+	key = JSONKey{Path: ".id", Missing: JSONMissingError}
+	tests.CheckNotError(t, key.CheckRecord(`{"id": "1"}`))
+	tests.CheckErrorIs(t, ErrBadRecord, key.CheckRecord(`{"id": 1}`))
+	tests.CheckErrorIs(t, ErrBadRecord, key.CheckRecord(`{"id": "1"`))
+	tests.CheckErrorIs(t, ErrBadRecord, key.CheckRecord(`{"id": "1", "x": }`))
+	tests.CheckNotError(t, JSONKey{Path: ".id"}.CheckRecord(`{`))
+}
+
+func Test_JSONKey_RecordKey(t *testing.T) {
+	records := []string{`{"n": 3}`, `{}`, `{"n": 1, "x": "b"}`, `{"n": 2}`, `{"n": 1, "x": "a"}`, `bad`, `{"n": "1"}`}
+
+	cfg := Config{JSONKey: JSONKey{Path: ".n", Type: JSONKeyTypeNumber}}
+	for _, reverse := range []bool{false, true} {
+		cfg.Reverse = reverse
+		cmp := cfg.GetCompare()
+		key := cfg.GetRecordKey()
+
+		extracted := 0
+		extract := key.Extract
+		key.Extract = func(record string) any {
+			extracted++
+			return extract(record)
+		}
+
+		chunk := NewArrStringsChunk(0)
+		for _, record := range records {
+			chunk.Add(record)
+		}
+		chunk.SortByKey(key, false)
+		tests.CheckExpected(t, len(records), extracted)
+		tests.CheckExpectedf(t, true, chunk.IsSorted(cmp), "reverse %v", reverse)
+
+		for i, lhs := range records {
+			for j, rhs := range records {
+				tests.CheckExpectedf(t, cmp(lhs, rhs), key.MakeCompare()(lhs, rhs), "records #%v, #%v", i, j)
+			}
+		}
+	}
+
+	tests.CheckExpected(t, true, Config{}.GetRecordKey().IsEmpty())
+}
@@ -0,0 +1,491 @@
+package extsort
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Key selects a part of a line the same way as 'sort -k' does.
+// Fields and chars are 1-based. Zero EndField means the end of the line,
+// zero EndChar means the end of the EndField field. Fields can be referred
+// by header column names, see ResolveKeyNames.
+type Key struct {
+	StartField int
+	StartChar  int
+	EndField   int
+	EndChar    int
+	StartName  string
+	EndName    string
+	KeyOptions
+}
+
+// KeyOptions are transforms applied to the extracted key before comparison
+// and the way the transformed keys are compared.
+type KeyOptions struct {
+	IgnoreLeadingBlanks bool        // 'b'
+	DictionaryOrder     bool        // 'd': only blanks and alphanumerics are compared
+	FoldCase            bool        // 'f': lower case letters are folded to upper case like in GNU sort
+	IgnoreNonPrinting   bool        // 'i'
+	Mode                CompareMode // 'n', 'g', 'h', 'V'
+	Reverse             bool        // 'r'
+}
+
+func (this Key) Check() error {
+	if this.StartField <= 0 && this.StartName == "" {
+		return fmt.Errorf("%w: key start field must be positive", ErrBadConfig)
+	}
+
+	if this.StartChar < 0 {
+		return fmt.Errorf("%w: key start char is negative", ErrBadConfig)
+	}
+
+	if this.EndField < 0 {
+		return fmt.Errorf("%w: key end field is negative", ErrBadConfig)
+	}
+
+	if this.EndChar < 0 {
+		return fmt.Errorf("%w: key end char is negative", ErrBadConfig)
+	}
+
+	if this.EndField == 0 && this.EndName == "" && this.EndChar != 0 {
+		return fmt.Errorf("%w: key end char is specified without end field", ErrBadConfig)
+	}
+
+	if this.EndField != 0 && this.StartField != 0 && this.EndField < this.StartField {
+		return fmt.Errorf("%w: key end field is less than start field", ErrBadConfig)
+	}
+
+	return this.Mode.Check()
+}
+
+func (this Key) Extract(line string, separator string) string {
+	return this.extract(line, func(field int) (int, int) {
+		return findField(line, separator, field)
+	})
+}
+
+// ExtractFromFields extracts the key from the already split fields as if they were joined by the separator.
+func (this Key) ExtractFromFields(fields []string, separator string) string {
+	return this.extract(strings.Join(fields, separator), func(field int) (int, int) {
+		return findJoinedField(fields, separator, field)
+	})
+}
+
+// ExtractCSV extracts the key from the unquoted CSV fields of the record. Only fields of the key
+// are looked for, they are unquoted with allocations only if some of them are quoted.
+func (this Key) ExtractCSV(record string, comma byte) string {
+	begin, end, quoted, found := findCSVFields(record, comma, this.StartField, this.EndField)
+	if !found {
+		return ""
+	}
+
+	key := this // fields of the key are counted from the start field
+	key.StartField = 1
+	if key.EndField > 0 {
+		key.EndField -= this.StartField - 1
+	}
+
+	if !quoted {
+		return key.Extract(record[begin:end], string(comma))
+	}
+	return key.ExtractFromFields(SplitCSVRecord(record[begin:end], comma), string(comma))
+}
+
+func (this Key) HasNames() bool {
+	return this.StartName != "" || this.EndName != ""
+}
+
+func (this Key) extract(line string, findField func(field int) (begin int, end int)) string {
+	startFieldBegin, startFieldEnd := findField(this.StartField)
+
+	begin := startFieldBegin
+	if this.IgnoreLeadingBlanks {
+		begin = skipBlanks(line[:startFieldEnd], begin)
+	}
+	if this.StartChar > 1 {
+		begin += this.StartChar - 1
+	}
+	if begin > startFieldEnd {
+		begin = startFieldEnd
+	}
+
+	end := len(line)
+	if this.EndField > 0 {
+		endFieldBegin, endFieldEnd := findField(this.EndField)
+		if this.IgnoreLeadingBlanks {
+			endFieldBegin = skipBlanks(line[:endFieldEnd], endFieldBegin)
+		}
+		end = endFieldEnd
+		if this.EndChar > 0 && endFieldBegin+this.EndChar < endFieldEnd {
+			end = endFieldBegin + this.EndChar
+		}
+	}
+
+	if end <= begin {
+		return ""
+	}
+
+	return line[begin:end]
+}
+
+func (this Key) String() string {
+	result := formatKeyField(this.StartField, this.StartName)
+	if this.StartChar > 0 {
+		result += "." + strconv.Itoa(this.StartChar)
+	}
+	if this.EndField > 0 || this.EndName != "" {
+		result += "," + formatKeyField(this.EndField, this.EndName)
+		if this.EndChar > 0 {
+			result += "." + strconv.Itoa(this.EndChar)
+		}
+	}
+	return result + this.KeyOptions.String()
+}
+
+// ParseKey parses the 'F[.C][OPTS][,F[.C][OPTS]]' key definition, where OPTS are letters of KeyOptions.
+// The field F is either a number or a header column name in brackets, e.g. '[price]n'.
+func ParseKey(def string) (Key, error) {
+	key := Key{}
+
+	start, end, hasEnd := cutOutsideBrackets(def, func(c byte) bool { return c == ',' })
+
+	var err error
+	key.StartField, key.StartName, key.StartChar, err = parseKeyPos(start, &key.KeyOptions)
+	if err != nil {
+		return key, fmt.Errorf("%w: bad key '%v': %v", ErrBadConfig, def, err)
+	}
+
+	if hasEnd {
+		key.EndField, key.EndName, key.EndChar, err = parseKeyPos(end, &key.KeyOptions)
+		if err != nil {
+			return key, fmt.Errorf("%w: bad key '%v': %v", ErrBadConfig, def, err)
+		}
+	}
+
+	return key, key.Check()
+}
+
+// ParseKeys parses blank separated key definitions, e.g. '3,3 5,5nr [unit price]'.
+func ParseKeys(spec string) ([]Key, error) {
+	keys := make([]Key, 0)
+	for spec != "" {
+		def, rest, _ := cutOutsideBrackets(spec, isBlank)
+		spec = rest
+		if def == "" {
+			continue
+		}
+		key, err := ParseKey(def)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// ResolveKeyNames sets fields of the keys referring to the columns by names.
+func ResolveKeyNames(keys []Key, columns []string) ([]Key, error) {
+	resolve := func(name string, field *int) error {
+		if name == "" {
+			return nil
+		}
+		for i, column := range columns {
+			if column == name {
+				*field = i + 1
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: unknown key column '%v'", ErrBadConfig, name)
+	}
+
+	result := make([]Key, 0, len(keys))
+	for _, key := range keys {
+		if err := resolve(key.StartName, &key.StartField); err != nil {
+			return nil, err
+		}
+		if err := resolve(key.EndName, &key.EndField); err != nil {
+			return nil, err
+		}
+		if err := key.Check(); err != nil {
+			return nil, err
+		}
+		result = append(result, key)
+	}
+	return result, nil
+}
+
+func KeysToString(keys []Key) string {
+	defs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		defs = append(defs, key.String())
+	}
+	return strings.Join(defs, " ")
+}
+
+func parseKeyPos(pos string, opts *KeyOptions) (field int, name string, char int, err error) {
+	if strings.HasPrefix(pos, "[") {
+		end := strings.IndexByte(pos, ']')
+		if end < 0 {
+			return 0, "", 0, fmt.Errorf("unclosed column name")
+		}
+		name = pos[1:end]
+		if name == "" {
+			return 0, "", 0, fmt.Errorf("empty column name")
+		}
+		pos = pos[end+1:]
+	}
+
+	optsBegin := strings.IndexFunc(pos, func(r rune) bool {
+		return r != '.' && !unicode.IsDigit(r)
+	})
+	if optsBegin >= 0 {
+		err = opts.parse(pos[optsBegin:])
+		if err != nil {
+			return 0, "", 0, err
+		}
+		pos = pos[:optsBegin]
+	}
+
+	fieldStr, charStr, hasChar := strings.Cut(pos, ".")
+
+	if name == "" {
+		field, err = strconv.Atoi(fieldStr)
+		if err != nil {
+			return 0, "", 0, err
+		}
+	} else if fieldStr != "" {
+		return 0, "", 0, fmt.Errorf("unexpected '%v' after column name", fieldStr)
+	}
+
+	if hasChar {
+		char, err = strconv.Atoi(charStr)
+		if err != nil {
+			return 0, "", 0, err
+		}
+	}
+
+	return field, name, char, nil
+}
+
+func formatKeyField(field int, name string) string {
+	if name != "" {
+		return "[" + name + "]"
+	}
+	return strconv.Itoa(field)
+}
+
+// cutOutsideBrackets cuts the string around the first separator which is not enclosed in brackets.
+func cutOutsideBrackets(str string, isSeparator func(c byte) bool) (before string, after string, found bool) {
+	inBrackets := false
+	for i := 0; i < len(str); i++ {
+		switch {
+		case str[i] == '[':
+			inBrackets = true
+		case str[i] == ']':
+			inBrackets = false
+		case !inBrackets && isSeparator(str[i]):
+			return str[:i], str[i+1:], true
+		}
+	}
+	return str, "", false
+}
+
+// MakeKeysCompare makes the compare of lines by the keys one by one. The cmp compares
+// keys in the CompareModeBytes mode, other modes use their own compares.
+func MakeKeysCompare(keys []Key, separator string, cmp Compare) Compare {
+	prepare := func(line string) string { return line }
+	return makeKeysCompare(keys, cmp, prepare, func(key Key, line string) string {
+		return key.Extract(line, separator)
+	})
+}
+
+// MakeCSVKeysCompare is like MakeKeysCompare, but the keys are extracted from the unquoted CSV fields.
+func MakeCSVKeysCompare(keys []Key, comma byte, cmp Compare) Compare {
+	prepare := func(line string) string { return line }
+	return makeKeysCompare(keys, cmp, prepare, func(key Key, line string) string {
+		return key.ExtractCSV(line, comma)
+	})
+}
+
+// MakeExtractedKeyCompare makes the compare of records by keys the extract returns.
+func MakeExtractedKeyCompare(extract func(record string) string, cmp Compare) Compare {
+	cmp = CompareOrDefault(cmp)
+	return func(lhs, rhs string) int {
+		return cmp(extract(lhs), extract(rhs))
+	}
+}
+
+func makeKeysCompare[T any](keys []Key, cmp Compare, prepare func(line string) T, extract func(key Key, prepared T) string) Compare {
+	cmp = CompareOrDefault(cmp)
+
+	if len(keys) == 0 {
+		return cmp
+	}
+
+	keys = append([]Key(nil), keys...)
+	compares := make([]Compare, 0, len(keys))
+	for _, key := range keys {
+		compares = append(compares, key.MakeCompare(cmp))
+	}
+
+	return func(lhs, rhs string) int {
+		lhsPrepared := prepare(lhs)
+		rhsPrepared := prepare(rhs)
+		for i, key := range keys {
+			lhsKey := key.Transform(extract(key, lhsPrepared))
+			rhsKey := key.Transform(extract(key, rhsPrepared))
+			result := compares[i](lhsKey, rhsKey)
+			if result != 0 {
+				return result
+			}
+		}
+		return 0
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+func (this KeyOptions) Transform(key string) string {
+	if !this.DictionaryOrder && !this.IgnoreNonPrinting && !this.FoldCase {
+		return key
+	}
+
+	return strings.Map(func(r rune) rune {
+		if this.DictionaryOrder && r != ' ' && r != '\t' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return -1
+		}
+		if this.IgnoreNonPrinting && !unicode.IsPrint(r) {
+			return -1
+		}
+		if this.FoldCase {
+			return unicode.ToUpper(unicode.ToLower(r))
+		}
+		return r
+	}, key)
+}
+
+func (this KeyOptions) MakeCompare(bytesCompare Compare) Compare {
+	cmp := CompareOrDefault(bytesCompare)
+	if this.Mode != CompareModeBytes {
+		cmp = this.Mode.Compare()
+	}
+	if this.Reverse {
+		cmp = ReverseCompare(cmp)
+	}
+	return cmp
+}
+
+func (this KeyOptions) IsEmpty() bool {
+	return this == KeyOptions{}
+}
+
+func (this KeyOptions) String() string {
+	result := ""
+	for _, opt := range this.flags() {
+		if *opt.flag {
+			result += string(opt.letter)
+		}
+	}
+	if this.Mode.Check() == nil && this.Mode != CompareModeBytes {
+		result += string(compareModes[this.Mode].letter)
+	}
+	return result
+}
+
+func (this *KeyOptions) parse(letters string) error {
+	flags := this.flags()
+	for _, letter := range letters {
+		found := false
+		for _, opt := range flags {
+			if opt.letter == letter {
+				*opt.flag = true
+				found = true
+			}
+		}
+		for mode, m := range compareModes {
+			if m.letter == letter {
+				if this.Mode != CompareModeBytes && this.Mode != CompareMode(mode) {
+					return fmt.Errorf("incompatible key options '%c' and '%c'", compareModes[this.Mode].letter, letter)
+				}
+				this.Mode = CompareMode(mode)
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown key option '%c'", letter)
+		}
+	}
+	return nil
+}
+
+func (this *KeyOptions) flags() []keyOptionFlag {
+	return []keyOptionFlag{
+		{'b', &this.IgnoreLeadingBlanks},
+		{'d', &this.DictionaryOrder},
+		{'f', &this.FoldCase},
+		{'i', &this.IgnoreNonPrinting},
+		{'r', &this.Reverse},
+	}
+}
+
+type keyOptionFlag struct {
+	letter rune
+	flag   *bool
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// findField returns bounds of the field. Without separator fields are separated by the
+// empty string between a non-blank and a blank char, so leading blanks belong to the field.
+func findField(line string, separator string, field int) (begin int, end int) {
+	begin = 0
+	for i := 1; ; i++ {
+		if separator != "" {
+			idx := strings.Index(line[begin:], separator)
+			if idx < 0 {
+				end = len(line)
+			} else {
+				end = begin + idx
+			}
+		} else {
+			end = begin
+			for end < len(line) && isBlank(line[end]) {
+				end++
+			}
+			for end < len(line) && !isBlank(line[end]) {
+				end++
+			}
+		}
+
+		if i == field {
+			return begin, end
+		}
+
+		if end >= len(line) {
+			return len(line), len(line)
+		}
+
+		begin = end + len(separator)
+	}
+}
+
+func findJoinedField(fields []string, separator string, field int) (begin int, end int) {
+	begin = 0
+	for i, f := range fields {
+		if i+1 == field {
+			return begin, begin + len(f)
+		}
+		begin += len(f) + len(separator)
+	}
+	end = begin - len(separator)
+	if end < 0 {
+		end = 0
+	}
+	return end, end
+}
+
+func isBlank(c byte) bool {
+	return c == ' ' || c == '\t'
+}
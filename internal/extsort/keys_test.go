@@ -0,0 +1,207 @@
+package extsort
+
+import (
+	"testing"
+
+	"github.com/kdpdev/extsort/internal/utils/tests"
+)
+
+func Test_Key_Extract(t *testing.T) {
+	cases := []struct {
+		line      string
+		separator string
+		key       Key
+		expected  string
+	}{
+		{"a b c", "", Key{StartField: 1}, "a b c"},
+		{"a b c", "", Key{StartField: 2}, " b c"},
+		{"a b c", "", Key{StartField: 2, EndField: 2}, " b"},
+		{"a  bcd c", "", Key{StartField: 2, StartChar: 4, EndField: 2}, "cd"},
+		{"a  bcd c", "", Key{StartField: 2, StartChar: 3, EndField: 2, EndChar: 4}, "bc"},
+		{"a b", "", Key{StartField: 3}, ""},
+		{"a b", "", Key{StartField: 1, StartChar: 10, EndField: 1}, ""},
+		{"a,b,c", ",", Key{StartField: 2}, "b,c"},
+		{"a,b,c", ",", Key{StartField: 2, EndField: 2}, "b"},
+		{"a,,c", ",", Key{StartField: 2, EndField: 2}, ""},
+		{"a,", ",", Key{StartField: 2, EndField: 2}, ""},
+		{"a::bb::c", "::", Key{StartField: 2, EndField: 2}, "bb"},
+		{"a,bcd,e", ",", Key{StartField: 2, StartChar: 2, EndField: 3, EndChar: 1}, "cd,e"},
+		{"a   bcd c", "", Key{StartField: 2, StartChar: 2, EndField: 2, KeyOptions: KeyOptions{IgnoreLeadingBlanks: true}}, "cd"},
+		{"a   bcd c", "", Key{StartField: 2, EndField: 2, EndChar: 2, KeyOptions: KeyOptions{IgnoreLeadingBlanks: true}}, "bc"},
+		{"a   bcd c", "", Key{StartField: 2, StartChar: 2, EndField: 2}, "  bcd"},
+	}
+
+	for i, c := range cases {
+		tests.CheckExpectedf(t, c.expected, c.key.Extract(c.line, c.separator), "case %v", i)
+	}
+}
+
+func Test_ParseKey(t *testing.T) {
+	cases := map[string]Key{
+		"1":             {StartField: 1},
+		"2,3":           {StartField: 2, EndField: 3},
+		"2.3,4.5":       {StartField: 2, StartChar: 3, EndField: 4, EndChar: 5},
+		"2.3":           {StartField: 2, StartChar: 3},
+		"2,3bf":         {StartField: 2, EndField: 3, KeyOptions: KeyOptions{IgnoreLeadingBlanks: true, FoldCase: true}},
+		"1di":           {StartField: 1, KeyOptions: KeyOptions{DictionaryOrder: true, IgnoreNonPrinting: true}},
+		"5,5rn":         {StartField: 5, EndField: 5, KeyOptions: KeyOptions{Mode: CompareModeNumeric, Reverse: true}},
+		"2V":            {StartField: 2, KeyOptions: KeyOptions{Mode: CompareModeVersion}},
+		"[a b]":         {StartName: "a b"},
+		"[x,y].2,[z]rn": {StartName: "x,y", StartChar: 2, EndName: "z", KeyOptions: KeyOptions{Mode: CompareModeNumeric, Reverse: true}},
+	}
+
+	for def, expected := range cases {
+		key, err := ParseKey(def)
+		tests.CheckNotErrorf(t, err, "key '%v'", def)
+		tests.CheckExpectedf(t, expected, key, "key '%v'", def)
+		tests.CheckExpected(t, def, key.String())
+	}
+
+	key, err := ParseKey("2.1,3.4f")
+	tests.CheckNotError(t, err)
+	tests.CheckExpected(t, true, key.FoldCase)
+
+	for _, def := range []string{"", "0", "a", "1,", "2,1", "1.x", "-1", "1z", "1b.2", "1nh", "1,2gV", "[]", "[a", "[a]1", "1,[b"} {
+		_, err := ParseKey(def)
+		tests.CheckErrorIsf(t, ErrBadConfig, err, "key '%v'", def)
+	}
+}
+
+func Test_KeysCompare(t *testing.T) {
+	cmp := MakeKeysCompare([]Key{{StartField: 2, EndField: 2}}, ",", nil)
+	tests.CheckExpected(t, -1, cmp("b,1", "a,2"))
+	tests.CheckExpected(t, 1, cmp("a,2", "b,1"))
+	tests.CheckExpected(t, 0, cmp("a,1", "b,1"))
+	tests.CheckExpected(t, 0, cmp("a,1", "a,1"))
+
+	cmp = MakeKeysCompare(nil, "", nil)
+	tests.CheckExpected(t, -1, cmp("a", "b"))
+}
+
+func Test_KeyOptions_Transform(t *testing.T) {
+	tests.CheckExpected(t, "AbC", KeyOptions{}.Transform("AbC"))
+	tests.CheckExpected(t, "ABC ßΣ", KeyOptions{FoldCase: true}.Transform("AbC ßσ"))
+	tests.CheckExpected(t, "ab 1Ж", KeyOptions{DictionaryOrder: true}.Transform("a-b, 1.Ж!"))
+	tests.CheckExpected(t, "ab c", KeyOptions{IgnoreNonPrinting: true}.Transform("a\x01b\t c\x7f"))
+	tests.CheckExpected(t, "AB", KeyOptions{DictionaryOrder: true, FoldCase: true}.Transform("A.b"))
+
+	cmp := MakeKeysCompare([]Key{{StartField: 1, KeyOptions: KeyOptions{FoldCase: true}}}, "", nil)
+	tests.CheckExpected(t, 0, cmp("ABC", "abc"))
+	tests.CheckExpected(t, -1, cmp("abc", "ABD"))
+
+	// like in GNU sort, the case is folded to upper, so the punctuation between 'Z' and 'a' goes after letters
+	checkCompareOrder(t, cmp,
+		[]string{"a", "A"},
+		[]string{"B", "b"},
+		[]string{"z"},
+		[]string{"["},
+		[]string{"_"},
+		[]string{"`"},
+		[]string{"{"},
+	)
+}
+
+func Test_ParseKeys(t *testing.T) {
+	keys, err := ParseKeys(" 3,3  5,5nr\t1f ")
+	tests.CheckNotError(t, err)
+	tests.CheckExpected(t, 3, len(keys))
+	tests.CheckExpected(t, Key{StartField: 3, EndField: 3}, keys[0])
+	tests.CheckExpected(t, Key{StartField: 5, EndField: 5, KeyOptions: KeyOptions{Mode: CompareModeNumeric, Reverse: true}}, keys[1])
+	tests.CheckExpected(t, Key{StartField: 1, KeyOptions: KeyOptions{FoldCase: true}}, keys[2])
+	tests.CheckExpected(t, "3,3 5,5rn 1f", KeysToString(keys))
+
+	keys, err = ParseKeys("[unit price]n 2")
+	tests.CheckNotError(t, err)
+	tests.CheckExpected(t, 2, len(keys))
+	tests.CheckExpected(t, Key{StartName: "unit price", KeyOptions: KeyOptions{Mode: CompareModeNumeric}}, keys[0])
+
+	keys, err = ParseKeys("")
+	tests.CheckNotError(t, err)
+	tests.CheckExpected(t, 0, len(keys))
+
+	_, err = ParseKeys("1 x")
+	tests.CheckErrorIs(t, ErrBadConfig, err)
+}
+
+func Test_Config_GetCompare(t *testing.T) {
+	cfg := Config{FieldSeparator: ","}
+	cfg.Keys, _ = ParseKeys("1,1 2,2nr")
+	cmp := cfg.GetCompare()
+	tests.CheckExpected(t, -1, cmp("a,10", "b,9"))
+	tests.CheckExpected(t, -1, cmp("a,10", "a,9"))
+	tests.CheckExpected(t, 1, cmp("a,9", "a,09"))
+
+	cfg.Stable = true
+	cmp = cfg.GetCompare()
+	tests.CheckExpected(t, 0, cmp("a,9", "a,09"))
+
+	cfg = Config{FieldSeparator: ",", CompareMode: CompareModeNumeric, Reverse: true}
+	cfg.Keys, _ = ParseKeys("2,2 1,1")
+	cmp = cfg.GetCompare()
+	tests.CheckExpected(t, -1, cmp("a,10", "b,9"))
+	tests.CheckExpected(t, 1, cmp("a,1", "b,1")) // both keys are numeric and equal, the last resort is reversed
+	tests.CheckExpected(t, -1, cmp("a,1", "a,01"))
+
+	cfg = Config{CompareMode: CompareModeNumeric, Reverse: true}
+	cmp = cfg.GetCompare()
+	tests.CheckExpected(t, -1, cmp("10", "9"))
+	tests.CheckExpected(t, -1, cmp("9", "09"))
+}
+
+func Test_Key_ExtractFromFields(t *testing.T) {
+	fields := []string{"a,b", "", "cde"}
+	tests.CheckExpected(t, "a,b", Key{StartField: 1, EndField: 1}.ExtractFromFields(fields, ","))
+	tests.CheckExpected(t, "", Key{StartField: 2, EndField: 2}.ExtractFromFields(fields, ","))
+	tests.CheckExpected(t, ",cde", Key{StartField: 2}.ExtractFromFields(fields, ","))
+	tests.CheckExpected(t, "b,,c", Key{StartField: 1, StartChar: 3, EndField: 3, EndChar: 1}.ExtractFromFields(fields, ","))
+	tests.CheckExpected(t, "", Key{StartField: 4}.ExtractFromFields(fields, ","))
+}
+
+func Test_Key_ExtractCSV(t *testing.T) {
+	records := []string{"", "a", "a,b", ",", "a,,c,", `"a,b",,cde`, `x,"y""z",w`, `x,"y" z,w`, `x,y,"unclosed,z`, " a , b ,c"}
+	keys := []Key{
+		{StartField: 1},
+		{StartField: 2},
+		{StartField: 2, EndField: 2},
+		{StartField: 1, StartChar: 3, EndField: 3, EndChar: 1},
+		{StartField: 2, StartChar: 2, EndField: 3},
+		{StartField: 3, EndField: 5},
+		{StartField: 5},
+		{StartField: 2, EndField: 3, KeyOptions: KeyOptions{IgnoreLeadingBlanks: true}},
+	}
+
+	for _, record := range records {
+		for _, key := range keys {
+			expected := key.ExtractFromFields(SplitCSVRecord(record, ','), ",")
+			tests.CheckExpectedf(t, expected, key.ExtractCSV(record, ','), "record '%v', key '%v'", record, key)
+		}
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		Key{StartField: 2, EndField: 3}.ExtractCSV(`"a,b",c,d,"e"`, ',')
+	})
+	tests.CheckExpected(t, 0.0, allocs)
+}
+
+func Test_ResolveKeyNames(t *testing.T) {
+	keys, err := ParseKeys("[price]n [id],[name] 1")
+	tests.CheckNotError(t, err)
+
+	resolved, err := ResolveKeyNames(keys, []string{"id", "name", "price"})
+	tests.CheckNotError(t, err)
+	tests.CheckExpected(t, 3, resolved[0].StartField)
+	tests.CheckExpected(t, 0, resolved[0].EndField)
+	tests.CheckExpected(t, 1, resolved[1].StartField)
+	tests.CheckExpected(t, 2, resolved[1].EndField)
+	tests.CheckExpected(t, 1, resolved[2].StartField)
+	tests.CheckExpected(t, 0, keys[0].StartField)
+
+	_, err = ResolveKeyNames(keys, []string{"id", "name"})
+	tests.CheckErrorIs(t, ErrBadConfig, err)
+
+	_, err = ResolveKeyNames(keys, []string{"name", "id", "price"})
+	tests.CheckErrorIs(t, ErrBadConfig, err)
+
+	cfg := Config{Keys: keys}
+	tests.CheckErrorIs(t, ErrBadConfig, cfg.Check())
+}
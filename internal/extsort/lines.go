@@ -1,35 +1,46 @@
 package extsort
 
 import (
-	"bufio"
-	"bytes"
 	"context"
+	"errors"
 	"io"
 )
 
 type LinesGen func() (line string, done bool, err error)
 
 func NewSyncLinesGenFromReader(ctx context.Context, reader io.Reader) LinesGen {
-	scanner := newLinesScanner(reader)
+	return NewSyncRecordsGenFromReader(ctx, reader, RecordFormat{})
+}
+
+func NewSyncRecordsGenFromReader(ctx context.Context, reader io.Reader, format RecordFormat) LinesGen {
+	recordReader := format.Framing().NewReader(reader)
 	return func() (string, bool, error) {
 		if err := ctx.Err(); err != nil {
 			return "", true, err
 		}
-		if scanner.Scan() {
-			return scanner.Text(), false, nil
+		record, err := recordReader.ReadRecord()
+		if errors.Is(err, io.EOF) {
+			return "", true, nil
 		}
-		return "", true, scanner.Err()
+		if err != nil {
+			return "", true, err
+		}
+		return record, false, nil
 	}
 }
 
 func NewAsyncLinesFromReader(ctx context.Context, reader io.Reader) LinesGen {
-	linesChan, linesErr := NewLinesChan(ctx, reader)
+	return NewAsyncRecordsFromReader(ctx, reader, RecordFormat{})
+}
+
+func NewAsyncRecordsFromReader(ctx context.Context, reader io.Reader, format RecordFormat) LinesGen {
+	recordsChan, recordsErr := NewRecordsChan(ctx, reader, format)
 	return func() (string, bool, error) {
-		line, ok := <-linesChan
+		record, ok := <-recordsChan
 		if !ok {
-			return line, true, linesErr()
+			return record, true, recordsErr()
 		}
-		return line, false, nil
+		return record, false, nil
 	}
 }
 
@@ -58,46 +69,37 @@ func CollectLines(nextLine LinesGen) ([]string, error) {
 }
 
 func NewLinesChan(ctx context.Context, reader io.Reader) (<-chan string, func() error) {
-	linesChan := make(chan string)
+	return NewRecordsChan(ctx, reader, RecordFormat{})
+}
+
+func NewRecordsChan(ctx context.Context, reader io.Reader, format RecordFormat) (<-chan string, func() error) {
+	recordsChan := make(chan string)
 	var err error
 
 	go func() {
-		defer close(linesChan)
+		defer close(recordsChan)
 
-		scanner := newLinesScanner(reader)
+		recordReader := format.Framing().NewReader(reader)
+
+		for {
+			record, e := recordReader.ReadRecord()
+			if e != nil {
+				if !errors.Is(e, io.EOF) {
+					err = e
+				}
+				return
+			}
 
-		for scanner.Scan() {
 			select {
 			case <-ctx.Done():
 				err = ctx.Err()
 				return
 
-			case linesChan <- scanner.Text():
+			case recordsChan <- record:
 				continue
 			}
 		}
-
-		err = scanner.Err()
 	}()
 
-	return linesChan, func() error { return err }
-}
-
-func newLinesScanner(reader io.Reader) *bufio.Scanner {
-	scanner := bufio.NewScanner(reader)
-	scanner.Split(scanLines)
-	return scanner
-}
-
-func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
-	if atEOF && len(data) == 0 {
-		return 0, nil, nil
-	}
-	if i := bytes.IndexByte(data, '\n'); i >= 0 {
-		return i + 1, data[0:i], nil
-	}
-	if atEOF {
-		return len(data), data, nil
-	}
-	return 0, nil, nil
+	return recordsChan, func() error { return err }
 }
@@ -122,6 +122,53 @@ func Test_LinesReading(t *testing.T) {
 	}
 }
 
+func Test_RecordsReading_ZeroTerminated(t *testing.T) {
+	format := RecordFormat{ZeroTerminated: true}
+
+	records, err := CollectLines(NewSyncRecordsGenFromReader(context.Background(), strings.NewReader("a\nb\x00c\x00\x00d"), format))
+	tests.CheckNotError(t, err)
+	tests.CheckExpected(t, "a\nb|c||d", strings.Join(records, "|"))
+
+	asyncRecords, err := CollectLines(NewAsyncRecordsFromReader(context.Background(), strings.NewReader("a\nb\x00c\x00\x00d"), format))
+	tests.CheckNotError(t, err)
+	tests.CheckExpected(t, "a\nb|c||d", strings.Join(asyncRecords, "|"))
+
+	framing := format.Framing()
+	buf := &strings.Builder{}
+	writer := framing.NewWriter(buf)
+	for _, record := range records {
+		n, err := writer.WriteRecord(record)
+		tests.CheckNotError(t, err)
+		tests.CheckExpected(t, framing.SerializedSize(record), n)
+	}
+	tests.CheckExpected(t, "a\nb\x00c\x00\x00d\x00", buf.String())
+}
+
+func Test_RecordsReading_LongRecords(t *testing.T) {
+	long := strings.Repeat("x", 1024*1024)
+	input := "a\n" + long + "\nb\n" + long
+
+	records, err := CollectLines(NewSyncRecordsGenFromReader(context.Background(), strings.NewReader(input), RecordFormat{}))
+	tests.CheckNotError(t, err)
+	tests.CheckExpected(t, 4, len(records))
+	tests.CheckExpected(t, long, records[1])
+	tests.CheckExpected(t, long, records[3])
+
+	format := RecordFormat{MaxRecordSize: len(long)}
+	records, err = CollectLines(NewSyncRecordsGenFromReader(context.Background(), strings.NewReader(input), format))
+	tests.CheckNotError(t, err)
+	tests.CheckExpected(t, 4, len(records))
+
+	format.MaxRecordSize = len(long) - 1
+	records, err = CollectLines(NewSyncRecordsGenFromReader(context.Background(), strings.NewReader(input), format))
+	tests.CheckErrorIs(t, ErrRecordTooLong, err)
+	tests.CheckExpected(t, 1, len(records))
+
+	records, err = CollectLines(NewSyncRecordsGenFromReader(context.Background(), strings.NewReader("a\n"+long), format))
+	tests.CheckErrorIs(t, ErrRecordTooLong, err)
+	tests.CheckExpected(t, 1, len(records))
+}
+
 func Test_ReadLines_Cancel_1(t *testing.T) {
 	test := func(logPrefix string, create func(ctx context.Context, reader io.Reader) LinesGen) error {
 		linesCount := 4
@@ -267,3 +314,135 @@ func Test_ReadLines_Timeout(t *testing.T) {
 		tests.CheckNotErrorf(t, err, "timeout of '%v' lines gen failed", kind)
 	}
 }
+
+func Test_RecordsReading_CRLF(t *testing.T) {
+	format := RecordFormat{CRLF: true}
+
+	records, err := CollectLines(NewSyncRecordsGenFromReader(context.Background(), strings.NewReader("a\r\nb\nc\rd\r\n\r\ne\r"), format))
+	tests.CheckNotError(t, err)
+	tests.CheckExpected(t, "a|b|c\rd||e\r", strings.Join(records, "|"))
+
+	framing := format.Framing()
+	buf := &strings.Builder{}
+	writer := framing.NewWriter(buf)
+	for _, record := range records {
+		n, err := writer.WriteRecord(record)
+		tests.CheckNotError(t, err)
+		tests.CheckExpected(t, framing.SerializedSize(record), n)
+	}
+	tests.CheckExpected(t, "a\r\nb\r\nc\rd\r\n\r\ne\r\r\n", buf.String())
+
+	long := strings.Repeat("x", 1024*1024)
+	records, err = CollectLines(NewSyncRecordsGenFromReader(context.Background(), strings.NewReader(long+"\r\n"+long+"\r"+"\n"), format))
+	tests.CheckNotError(t, err)
+	tests.CheckExpected(t, 2, len(records))
+	tests.CheckExpected(t, long, records[0])
+	tests.CheckExpected(t, long, records[1])
+
+	tests.CheckErrorIs(t, ErrBadConfig, RecordFormat{CRLF: true, ZeroTerminated: true}.Check())
+}
+
+func Test_RecordsReading_CSV(t *testing.T) {
+	format := RecordFormat{CSV: true, CRLF: true}
+	input := "a,\"b\nc\"\n\"\"\"x\"\"\n\",y\r\nz\n\"q\"\r\n\"\",\"\"\"\""
+
+	records, err := CollectLines(NewSyncRecordsGenFromReader(context.Background(), strings.NewReader(input), format))
+	tests.CheckNotError(t, err)
+	tests.CheckExpected(t, "a,\"b\nc\"|\"\"\"x\"\"\n\",y|z|\"q\"|\"\",\"\"\"\"", strings.Join(records, "|"))
+
+	records, err = CollectLines(NewSyncRecordsGenFromReader(context.Background(), strings.NewReader("a,5\" disk,x\nb,1,y\nc,2,z\n"), format))
+	tests.CheckErrorIs(t, ErrBadRecord, err)
+	tests.CheckExpected(t, 0, len(records))
+
+	records, err = CollectLines(NewSyncRecordsGenFromReader(context.Background(), strings.NewReader("a,b\n\"c\"d,e\n"), format))
+	tests.CheckErrorIs(t, ErrBadRecord, err)
+	tests.CheckExpected(t, "a,b", strings.Join(records, "|"))
+
+	records, err = CollectLines(NewSyncRecordsGenFromReader(context.Background(), strings.NewReader("a,b\n\"unclosed\nrest"), format))
+	tests.CheckErrorIs(t, ErrBadRecord, err)
+	tests.CheckExpected(t, "a,b", strings.Join(records, "|"))
+
+	framing := Config{RecordFormat: format, FieldSeparator: ";"}.GetFraming()
+	record, err := framing.NewReader(strings.NewReader("a;\"b;\nc\";d\r\n")).ReadRecord()
+	tests.CheckNotError(t, err)
+	tests.CheckExpected(t, "a;\"b;\nc\";d", record)
+
+	_, err = framing.NewReader(strings.NewReader("a,\"b,c\"\n")).ReadRecord()
+	tests.CheckErrorIs(t, ErrBadRecord, err)
+}
+
+func Test_RecordsReading_FixedSize(t *testing.T) {
+	format := RecordFormat{FixedSize: 3}
+
+	records, err := CollectLines(NewSyncRecordsGenFromReader(context.Background(), strings.NewReader("ab\ncd\x00efg"), format))
+	tests.CheckNotError(t, err)
+	tests.CheckExpected(t, "ab\n|cd\x00|efg", strings.Join(records, "|"))
+
+	framing := format.Framing()
+	buf := &strings.Builder{}
+	writer := framing.NewWriter(buf)
+	for _, record := range records {
+		n, err := writer.WriteRecord(record)
+		tests.CheckNotError(t, err)
+		tests.CheckExpected(t, framing.SerializedSize(record), n)
+	}
+	tests.CheckExpected(t, "ab\ncd\x00efg", buf.String())
+
+	records, err = CollectLines(NewSyncRecordsGenFromReader(context.Background(), strings.NewReader("abcd"), format))
+	tests.CheckErrorIs(t, ErrBadRecord, err)
+	tests.CheckExpected(t, 1, len(records))
+
+	tests.CheckErrorIs(t, ErrBadConfig, RecordFormat{FixedSize: 3, CRLF: true}.Check())
+	tests.CheckErrorIs(t, ErrBadConfig, RecordFormat{FixedSize: -1}.Check())
+}
+
+func Test_RecordsReading_LengthPrefixed(t *testing.T) {
+	records := []string{"", "a\nb\x00c\r\n", strings.Repeat("\xff", 300)}
+
+	for _, prefix := range []LengthPrefix{LengthPrefixVarint, LengthPrefixUint32LE, LengthPrefixUint32BE} {
+		format := RecordFormat{LengthPrefix: prefix}
+
+		framing := format.Framing()
+		buf := &strings.Builder{}
+		writer := framing.NewWriter(buf)
+		for _, record := range records {
+			n, err := writer.WriteRecord(record)
+			tests.CheckNotError(t, err)
+			tests.CheckExpected(t, framing.SerializedSize(record), n)
+		}
+
+		read, err := CollectLines(NewSyncRecordsGenFromReader(context.Background(), strings.NewReader(buf.String()), format))
+		tests.CheckNotErrorf(t, err, "%v", prefix)
+		tests.CheckExpectedf(t, strings.Join(records, "|"), strings.Join(read, "|"), "%v", prefix)
+
+		data := buf.String()
+		_, err = CollectLines(NewSyncRecordsGenFromReader(context.Background(), strings.NewReader(data[:len(data)-1]), format))
+		tests.CheckErrorIsf(t, ErrBadRecord, err, "%v", prefix)
+
+		format.MaxRecordSize = 100
+		_, err = CollectLines(NewSyncRecordsGenFromReader(context.Background(), strings.NewReader(data), format))
+		tests.CheckErrorIsf(t, ErrRecordTooLong, err, "%v", prefix)
+	}
+
+	_, err := CollectLines(NewSyncRecordsGenFromReader(context.Background(), strings.NewReader("\x00\x00"), RecordFormat{LengthPrefix: LengthPrefixUint32LE}))
+	tests.CheckErrorIs(t, ErrBadRecord, err)
+
+	_, err = CollectLines(NewSyncRecordsGenFromReader(context.Background(), strings.NewReader(strings.Repeat("\xff", 11)+"abc"), RecordFormat{LengthPrefix: LengthPrefixVarint}))
+	tests.CheckErrorIs(t, ErrBadRecord, err)
+	tests.CheckExpected(t, true, strings.Contains(err.Error(), "record #1"))
+
+	corrupted := map[LengthPrefix]string{
+		LengthPrefixVarint:   "\xff\xff\xff\xff\xff\xff\xff\xff\xff\x01abc",
+		LengthPrefixUint32LE: "\xff\xff\xff\xffabc",
+		LengthPrefixUint32BE: "\xff\xff\xff\xffabc",
+	}
+	for prefix, data := range corrupted {
+		_, err = CollectLines(NewSyncRecordsGenFromReader(context.Background(), strings.NewReader(data), RecordFormat{LengthPrefix: prefix}))
+		tests.CheckErrorIsf(t, ErrBadRecord, err, "%v", prefix)
+	}
+
+	tests.CheckExpected(t, 2+300, RecordFormat{LengthPrefix: LengthPrefixVarint}.Framing().SerializedSize(strings.Repeat("x", 300)))
+	tests.CheckErrorIs(t, ErrBadConfig, RecordFormat{LengthPrefix: LengthPrefixVarint, CSV: true}.Check())
+	tests.CheckErrorIs(t, ErrBadConfig, RecordFormat{LengthPrefix: LengthPrefixVarint, FixedSize: 1}.Check())
+	tests.CheckErrorIs(t, ErrBadConfig, RecordFormat{LengthPrefix: -1}.Check())
+}
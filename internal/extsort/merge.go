@@ -3,6 +3,7 @@ package extsort
 import (
 	"bufio"
 	"context"
+	"errors"
 	"io"
 	"os"
 	"path/filepath"
@@ -15,6 +16,14 @@ type MergeOptions struct {
 	WriteBufSize int
 	ReadBufSize  int
 	WorkersCount int
+	Compare      Compare
+	RecordKey    RecordKey // replaces Compare if not empty, the key is extracted once per record
+	Unique       bool
+	Framing      RecordFraming // nil means newline terminated lines
+	Compress     bool          // input and merged files are compressed by flate at the TempCompressionLevel
+	FilePrefix   string        // "merged" if empty, distinguishes merges sharing the OutputDir
+
+	OnDuplicatesRemoved func(count int)
 }
 
 type MergingProgressListener func(ctx context.Context, left, right, out string) error
@@ -57,7 +66,11 @@ func merge(
 		updateProgress = func(ctx context.Context, left, right, out string) error { return nil }
 	}
 
-	getMergedFilePath := misc.MakeSequencedStringsGen(filepath.Join(opts.OutputDir, "merged_%06v"))
+	prefix := opts.FilePrefix
+	if prefix == "" {
+		prefix = "merged"
+	}
+	getMergedFilePath := misc.MakeSequencedStringsGen(filepath.Join(opts.OutputDir, prefix+"_%06v"))
 
 	if len(files) == 1 {
 		mergedFilePath := getMergedFilePath()
@@ -79,6 +92,16 @@ func merge(
 		}
 	}
 
+	mergedFilePath := ""
+	defer misc.InvokeIfError(&err, func() { // the last merge may be done before the failure
+		if mergedFilePath == "" {
+			return
+		}
+		if e := GetFs(ctx).Remove(mergedFilePath); e != nil {
+			OnUnhandledError(ctx, e)
+		}
+	})
+
 	proc := misc.NewAsyncProcessor(opts.WorkersCount)
 	defer onceErr.Invoke(proc.Close)
 
@@ -140,6 +163,9 @@ func merge(
 			mergeErr = updateProgress(ctx, mergedFilePath, lhsResult, rhsResult)
 			if mergeErr != nil {
 				onError(mergeErr)
+				if e := GetFs(ctx).Remove(mergedFilePath); e != nil {
+					OnUnhandledError(ctx, e)
+				}
 				return
 			}
 
@@ -156,7 +182,7 @@ func merge(
 		return resultChan
 	}
 
-	mergedFilePath := <-mergeImpl(files)
+	mergedFilePath = <-mergeImpl(files)
 
 	onceErr.TrySet(ctx.Err())
 
@@ -226,15 +252,27 @@ func MergeFiles(
 		}
 	}()
 
-	leftReader := bufio.NewReaderSize(left, opts.ReadBufSize)
-	rightReader := bufio.NewReaderSize(right, opts.ReadBufSize)
-	targetWriter := bufio.NewWriterSize(target, opts.WriteBufSize)
+	leftDecompressor := newTempFileReader(ctx, left, opts.Compress)
+	rightDecompressor := newTempFileReader(ctx, right, opts.Compress)
+	targetCompressor := newTempFileWriter(ctx, target, opts.Compress)
+
+	leftReader := bufio.NewReaderSize(leftDecompressor, opts.ReadBufSize)
+	rightReader := bufio.NewReaderSize(rightDecompressor, opts.ReadBufSize)
+	targetWriter := bufio.NewWriterSize(targetCompressor, opts.WriteBufSize)
 
-	err = MergeStreams(ctx, leftReader, rightReader, targetWriter)
+	err = MergeStreams(ctx, opts, leftReader, rightReader, targetWriter)
 	if err != nil {
 		return err
 	}
 
+	if err = targetCompressor.Close(); err != nil {
+		return err
+	}
+
+	if err = errors.Join(leftDecompressor.Close(), rightDecompressor.Close()); err != nil {
+		return err
+	}
+
 	closeLeft = false
 	if err = left.Close(); err == nil {
 		err = fs.Remove(leftFilePath)
@@ -254,7 +292,7 @@ func MergeFiles(
 	return nil
 }
 
-func MergeStreams(ctx context.Context, leftReader, rightReader io.Reader, out *bufio.Writer) (resultError error) {
+func MergeStreams(ctx context.Context, opts MergeOptions, leftReader, rightReader io.Reader, out *bufio.Writer) (resultError error) {
 	if resultError = ctx.Err(); resultError != nil {
 		return resultError
 	}
@@ -267,104 +305,71 @@ func MergeStreams(ctx context.Context, leftReader, rightReader io.Reader, out *b
 		resultError = out.Flush()
 	})
 
-	endOfLine := byte('\n')
+	cmp := makeKeyedCompare(opts.RecordKey, opts.Compare)
+	framing := FramingOrDefault(opts.Framing)
+	writer := framing.NewWriter(out)
 
-	writeLine := func(line string) error {
-		n, err := out.WriteString(line)
-		if err == nil {
-			err = out.WriteByte(endOfLine)
-			n += 1
-		}
-		if err != nil {
-			return err
+	duplicates := 0
+	defer func() {
+		if duplicates > 0 && opts.OnDuplicatesRemoved != nil {
+			opts.OnDuplicatesRemoved(duplicates)
 		}
+	}()
 
-		if n != len(line)+1 {
-			return ErrUnexpectedWrittenBytesCount
+	last := keyedRecord{}
+	hasLast := false
+
+	writeRecord := func(source *mergeSource) error {
+		if opts.Unique {
+			if hasLast && cmp.compare(last.record, last.key, source.record, source.key) == 0 {
+				duplicates++
+				return nil
+			}
+			last = keyedRecord{record: source.record, key: source.key}
+			hasLast = true
 		}
 
-		return nil
+		_, err := writer.WriteRecord(source.record)
+		return err
 	}
 
-	writeRest := func(getLine func() (string, bool, error)) error {
-		for {
-			line, done, err := getLine()
-			if done {
-				return err
-			}
-			err = writeLine(line)
-			if err != nil {
-				return err
-			}
-		}
+	left := &mergeSource{reader: framing.NewReader(leftReader), extract: opts.RecordKey.Extract}
+	right := &mergeSource{reader: framing.NewReader(rightReader), extract: opts.RecordKey.Extract}
+
+	hasLeft, err := left.next()
+	if err != nil {
+		return err
 	}
 
-	// NOTE: in case of async readers Context with Cancel is needed
-	getLeftLine := NewSyncLinesGenFromReader(ctx, leftReader)
-	getRightLine := NewSyncLinesGenFromReader(ctx, rightReader)
+	hasRight, err := right.next()
+	if err != nil {
+		return err
+	}
 
-	leftLine, done, err := getLeftLine()
-	if done {
-		if err != nil {
+	for hasLeft || hasRight {
+		if err = ctx.Err(); err != nil {
 			return err
 		}
 
-		return writeRest(getRightLine)
-	}
+		source := right
+		if hasLeft && (!hasRight || cmp.compare(left.record, left.key, right.record, right.key) <= 0) { // the left stream goes first on ties, it is taken from earlier chunks
+			source = left
+		}
 
-	rightLine, done, err := getRightLine()
-	if done {
-		if err != nil {
+		if err = writeRecord(source); err != nil {
 			return err
 		}
 
-		err = writeLine(leftLine)
+		hasRecord, err := source.next()
 		if err != nil {
 			return err
 		}
-
-		return writeRest(getLeftLine)
-	}
-
-	for {
-		if leftLine < rightLine {
-			err = writeLine(leftLine)
-			if err != nil {
-				return err
-			}
-
-			leftLine, done, err = getLeftLine()
-			if done {
-				if err != nil {
-					return err
-				}
-
-				err = writeLine(rightLine)
-				if err != nil {
-					return err
-				}
-
-				return writeRest(getRightLine)
-			}
+		if source == left {
+			hasLeft = hasRecord
 		} else {
-			err = writeLine(rightLine)
-			if err != nil {
-				return err
-			}
-
-			rightLine, done, err = getRightLine()
-			if done {
-				if err != nil {
-					return err
-				}
-
-				err = writeLine(leftLine)
-				if err != nil {
-					return err
-				}
-
-				return writeRest(getLeftLine)
-			}
+			hasRight = hasRecord
 		}
 	}
+
+	return nil
 }
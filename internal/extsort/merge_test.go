@@ -1,9 +1,10 @@
 package extsort
 
 import (
+	"bufio"
 	"context"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -25,8 +26,7 @@ func Test_MergeFiles_1(t *testing.T) {
 	tests.CheckErrorIs(t, os.ErrPermission, MergeFiles(tools.Ctx, tools.MergingOpts, "file", "file", "merged"))
 	tests.CheckNotError(t, tools.CheckAbsent("merged"))
 
-	tests.CheckExpected(t, 0, len(tools.UnhandledErrs()))
-	tests.CheckExpected(t, false, tools.Fs.HasOpenedEntries())
+	tools.CheckReleased(t)
 }
 
 func Test_MergeFiles_2(t *testing.T) {
@@ -43,8 +43,7 @@ func Test_MergeFiles_2(t *testing.T) {
 	tests.CheckErrorIs(t, os.ErrExist, MergeFiles(tools.Ctx, tools.MergingOpts, "left", "right", "merged"))
 	tests.CheckNotError(t, tools.CheckPresent("merged"))
 
-	tests.CheckExpected(t, 0, len(tools.UnhandledErrs()))
-	tests.CheckExpected(t, false, tools.Fs.HasOpenedEntries())
+	tools.CheckReleased(t)
 }
 
 func Test_MergeFiles_3(t *testing.T) {
@@ -58,15 +57,9 @@ func Test_MergeFiles_3(t *testing.T) {
 	tests.CheckNotError(t, tools.CheckPresent("merged"))
 	tests.CheckNotError(t, tools.CheckAbsent("left"))
 	tests.CheckNotError(t, tools.CheckAbsent("right"))
-	merged, _, err := tools.Fs.OpenReadFile("merged")
-	tests.CheckNotError(t, err)
-	mergedData, err := ioutil.ReadAll(merged)
-	tests.CheckNotError(t, err)
-	tests.CheckNotError(t, merged.Close())
-	tests.CheckExpected(t, lines, string(mergedData))
+	tests.CheckExpected(t, lines, tools.ReadFile(t, "merged"))
 
-	tests.CheckExpected(t, 0, len(tools.UnhandledErrs()))
-	tests.CheckExpected(t, false, tools.Fs.HasOpenedEntries())
+	tools.CheckReleased(t)
 }
 
 func Test_MergeFiles_4(t *testing.T) {
@@ -81,15 +74,9 @@ func Test_MergeFiles_4(t *testing.T) {
 	tests.CheckNotError(t, tools.CheckAbsent("left"))
 	tests.CheckNotError(t, tools.CheckAbsent("right"))
 
-	merged, _, err := tools.Fs.OpenReadFile("merged")
-	tests.CheckNotError(t, err)
-	mergedData, err := ioutil.ReadAll(merged)
-	tests.CheckNotError(t, err)
-	tests.CheckNotError(t, merged.Close())
-	tests.CheckExpected(t, lines, string(mergedData))
+	tests.CheckExpected(t, lines, tools.ReadFile(t, "merged"))
 
-	tests.CheckExpected(t, 0, len(tools.UnhandledErrs()))
-	tests.CheckExpected(t, false, tools.Fs.HasOpenedEntries())
+	tools.CheckReleased(t)
 }
 
 func Test_MergeFiles_5(t *testing.T) {
@@ -106,15 +93,105 @@ func Test_MergeFiles_5(t *testing.T) {
 	tests.CheckNotError(t, tools.CheckAbsent("left"))
 	tests.CheckNotError(t, tools.CheckAbsent("right"))
 
-	merged, _, err := tools.Fs.OpenReadFile("merged")
-	tests.CheckNotError(t, err)
-	mergedData, err := ioutil.ReadAll(merged)
-	tests.CheckNotError(t, err)
-	tests.CheckNotError(t, merged.Close())
-	tests.CheckExpected(t, expectedLines, string(mergedData))
+	tests.CheckExpected(t, expectedLines, tools.ReadFile(t, "merged"))
+
+	tools.CheckReleased(t)
+}
+
+func Test_MergeFiles_Compare(t *testing.T) {
+	tools := NewTestTools(t)
+
+	leftLines := "8\n6\n4\n2\n0\n"
+	rightLines := "9\n7\n5\n3\n1\n"
+	expectedLines := "9\n8\n7\n6\n5\n4\n3\n2\n1\n0\n"
+
+	tools.MergingOpts.Compare = ReverseCompare(nil)
+
+	tests.CheckNotError(t, tools.CreateFile("left", leftLines))
+	tests.CheckNotError(t, tools.CreateFile("right", rightLines))
+	tests.CheckNotError(t, MergeFiles(tools.Ctx, tools.MergingOpts, "left", "right", "merged"))
+
+	tests.CheckExpected(t, expectedLines, tools.ReadFile(t, "merged"))
 
-	tests.CheckExpected(t, 0, len(tools.UnhandledErrs()))
-	tests.CheckExpected(t, false, tools.Fs.HasOpenedEntries())
+	tools.CheckReleased(t)
+}
+
+func Test_MergeFiles_Unique(t *testing.T) {
+	tools := NewTestTools(t)
+
+	removed := 0
+	tools.MergingOpts.Unique = true
+	tools.MergingOpts.OnDuplicatesRemoved = func(count int) {
+		removed += count
+	}
+
+	tests.CheckNotError(t, tools.CreateFile("left", "0\n1\n1\n3\n"))
+	tests.CheckNotError(t, tools.CreateFile("right", "1\n2\n3\n"))
+	tests.CheckNotError(t, MergeFiles(tools.Ctx, tools.MergingOpts, "left", "right", "merged"))
+
+	tests.CheckExpected(t, "0\n1\n2\n3\n", tools.ReadFile(t, "merged"))
+	tests.CheckExpected(t, 3, removed)
+
+	tools.CheckReleased(t)
+}
+
+// semicolonFraming is a minimal custom framing, the merging does not know about it.
+type semicolonFraming struct{}
+
+func (semicolonFraming) NewReader(r io.Reader) RecordReader {
+	return semicolonReader{bufio.NewReader(r)}
+}
+
+func (semicolonFraming) NewWriter(w io.Writer) RecordWriter {
+	return semicolonWriter{w}
+}
+
+func (semicolonFraming) SerializedSize(record string) int {
+	return len(record) + 1
+}
+
+type semicolonReader struct{ reader *bufio.Reader }
+
+func (this semicolonReader) ReadRecord() (string, error) {
+	record, err := this.reader.ReadString(';')
+	if err != nil {
+		return "", err
+	}
+	return record[:len(record)-1], nil
+}
+
+type semicolonWriter struct{ writer io.Writer }
+
+func (this semicolonWriter) WriteRecord(record string) (int, error) {
+	return io.WriteString(this.writer, record+";")
+}
+
+func Test_MergeFiles_Framing(t *testing.T) {
+	tools := NewTestTools(t)
+
+	tools.MergingOpts.Framing = semicolonFraming{}
+
+	tests.CheckNotError(t, tools.CreateFile("left", "a\nb;d;"))
+	tests.CheckNotError(t, tools.CreateFile("right", "c;e\n;"))
+	tests.CheckNotError(t, MergeFiles(tools.Ctx, tools.MergingOpts, "left", "right", "merged"))
+
+	tests.CheckExpected(t, "a\nb;c;d;e\n;", tools.ReadFile(t, "merged"))
+
+	tools.CheckReleased(t)
+}
+
+func Test_MergeFiles_Version(t *testing.T) {
+	tools := NewTestTools(t)
+
+	tools.MergingOpts.Compare = VersionCompare
+
+	tests.CheckNotError(t, tools.CreateFile("left", "v1.2\nv1.10\n"))
+	tests.CheckNotError(t, tools.CreateFile("right", "v1.9\nv1.11\n"))
+	tests.CheckNotError(t, MergeFiles(tools.Ctx, tools.MergingOpts, "left", "right", "merged"))
+
+	tests.CheckExpected(t, "v1.2\nv1.9\nv1.10\nv1.11\n", tools.ReadFile(t, "merged"))
+
+	tools.CheckReleased(t)
 }
 
 func Test_MergeFiles_Cancel_1(t *testing.T) {
@@ -126,8 +203,7 @@ func Test_MergeFiles_Cancel_1(t *testing.T) {
 	tests.CheckErrorIs(t, context.Canceled, MergeFiles(ctx, tools.MergingOpts, "left", "right", "merged"))
 	tests.CheckNotError(t, tools.CheckAbsent("merged"))
 
-	tests.CheckExpected(t, 0, len(tools.UnhandledErrs()))
-	tests.CheckExpected(t, false, tools.Fs.HasOpenedEntries())
+	tools.CheckReleased(t)
 }
 
 func Test_MergeFiles_Cancel_2(t *testing.T) {
@@ -141,8 +217,7 @@ func Test_MergeFiles_Cancel_2(t *testing.T) {
 	tests.CheckErrorIs(t, context.Canceled, MergeFiles(ctx, tools.MergingOpts, "left", "right", "merged"))
 	tests.CheckNotError(t, tools.CheckAbsent("merged"))
 
-	tests.CheckExpected(t, 0, len(tools.UnhandledErrs()))
-	tests.CheckExpected(t, false, tools.Fs.HasOpenedEntries())
+	tools.CheckReleased(t)
 }
 
 func Test_MergeFiles_Timeout_1(t *testing.T) {
@@ -155,8 +230,7 @@ func Test_MergeFiles_Timeout_1(t *testing.T) {
 	tests.CheckErrorIs(t, context.DeadlineExceeded, MergeFiles(ctx, tools.MergingOpts, "left", "right", "merged"))
 	tests.CheckNotError(t, tools.CheckAbsent("merged"))
 
-	tests.CheckExpected(t, 0, len(tools.UnhandledErrs()))
-	tests.CheckExpected(t, false, tools.Fs.HasOpenedEntries())
+	tools.CheckReleased(t)
 }
 
 func Test_MergeFiles_Timeout_2(t *testing.T) {
@@ -171,16 +245,14 @@ func Test_MergeFiles_Timeout_2(t *testing.T) {
 	tests.CheckErrorIs(t, context.DeadlineExceeded, MergeFiles(ctx, tools.MergingOpts, "left", "right", "merged"))
 	tests.CheckNotError(t, tools.CheckAbsent("merged"))
 
-	tests.CheckExpected(t, 0, len(tools.UnhandledErrs()))
-	tests.CheckExpected(t, false, tools.Fs.HasOpenedEntries())
+	tools.CheckReleased(t)
 }
 
 func Test_Merge_1(t *testing.T) {
 	tools := NewTestTools(t)
 	_, err := Merge(tools.Ctx, nil, tools.MergingOpts, nil)
 	tests.CheckErrorIs(t, ErrNoFiles, err)
-	tests.CheckExpected(t, 0, len(tools.UnhandledErrs()))
-	tests.CheckExpected(t, false, tools.Fs.HasOpenedEntries())
+	tools.CheckReleased(t)
 }
 
 func Test_Merge_2(t *testing.T) {
@@ -193,8 +265,7 @@ func Test_Merge_2(t *testing.T) {
 	tests.CheckNotError(t, tools.CheckPresent(merged))
 	dir, _ := filepath.Split(merged)
 	tests.CheckExpected(t, tools.MergingOpts.OutputDir, strings.TrimRight(dir, string(filepath.Separator)))
-	tests.CheckExpected(t, 0, len(tools.UnhandledErrs()))
-	tests.CheckExpected(t, false, tools.Fs.HasOpenedEntries())
+	tools.CheckReleased(t)
 }
 
 func Test_Merge_3(t *testing.T) {
@@ -209,8 +280,7 @@ func Test_Merge_3(t *testing.T) {
 	tests.CheckNotError(t, tools.CheckPresent(merged))
 	dir, _ := filepath.Split(merged)
 	tests.CheckExpected(t, tools.MergingOpts.OutputDir, strings.TrimRight(dir, string(filepath.Separator)))
-	tests.CheckExpected(t, 0, len(tools.UnhandledErrs()))
-	tests.CheckExpected(t, false, tools.Fs.HasOpenedEntries())
+	tools.CheckReleased(t)
 }
 
 func Test_Merge_4(t *testing.T) {
@@ -232,18 +302,12 @@ func Test_Merge_4(t *testing.T) {
 	dir, _ := filepath.Split(mergedPath)
 	tests.CheckExpected(t, tools.MergingOpts.OutputDir, strings.TrimRight(dir, string(filepath.Separator)))
 
-	mergedFile, _, err := tools.Fs.OpenReadFile(mergedPath)
-	tests.CheckNotError(t, err)
-
-	mergedData, err := ioutil.ReadAll(mergedFile)
-	tests.CheckNotError(t, err)
-	tests.CheckNotError(t, mergedFile.Close())
+	mergedData := tools.ReadFile(t, mergedPath)
 
-	mergedStr := string(mergedData)
+	mergedStr := mergedData
 	tests.CheckExpected(t, strings.ReplaceAll(lines3+lines2+lines1, "\n", "_"), strings.ReplaceAll(mergedStr, "\n", "_"))
 
-	tests.CheckExpected(t, 0, len(tools.UnhandledErrs()))
-	tests.CheckExpected(t, false, tools.Fs.HasOpenedEntries())
+	tools.CheckReleased(t)
 }
 
 func Test_Merge_Cancel_1(t *testing.T) {
@@ -257,8 +321,7 @@ func Test_Merge_Cancel_1(t *testing.T) {
 	})
 
 	tests.CheckErrorIs(t, context.Canceled, err)
-	tests.CheckExpected(t, 0, len(tools.UnhandledErrs()))
-	tests.CheckExpected(t, false, tools.Fs.HasOpenedEntries())
+	tools.CheckReleased(t)
 }
 
 func Test_Merge_Cancel_2(t *testing.T) {
@@ -272,8 +335,7 @@ func Test_Merge_Cancel_2(t *testing.T) {
 	})
 
 	tests.CheckErrorIs(t, context.Canceled, err)
-	tests.CheckExpected(t, 0, len(tools.UnhandledErrs()))
-	tests.CheckExpected(t, false, tools.Fs.HasOpenedEntries())
+	tools.CheckReleased(t)
 }
 
 func Test_Merge_Cancel_3(t *testing.T) {
@@ -302,8 +364,7 @@ func Test_Merge_Cancel_3(t *testing.T) {
 	})
 
 	tests.CheckErrorIs(t, context.Canceled, err)
-	tests.CheckExpected(t, 0, len(tools.UnhandledErrs()))
-	tests.CheckExpected(t, false, tools.Fs.HasOpenedEntries())
+	tools.CheckReleased(t)
 }
 
 func Test_Merge_Timeout_1(t *testing.T) {
@@ -318,8 +379,7 @@ func Test_Merge_Timeout_1(t *testing.T) {
 	})
 
 	tests.CheckErrorIs(t, context.DeadlineExceeded, err)
-	tests.CheckExpected(t, 0, len(tools.UnhandledErrs()))
-	tests.CheckExpected(t, false, tools.Fs.HasOpenedEntries())
+	tools.CheckReleased(t)
 }
 
 func Test_Merge_Timeout_2(t *testing.T) {
@@ -334,8 +394,7 @@ func Test_Merge_Timeout_2(t *testing.T) {
 	})
 
 	tests.CheckErrorIs(t, context.DeadlineExceeded, err)
-	tests.CheckExpected(t, 0, len(tools.UnhandledErrs()))
-	tests.CheckExpected(t, false, tools.Fs.HasOpenedEntries())
+	tools.CheckReleased(t)
 }
 
 func Test_Merge_Timeout_3(t *testing.T) {
@@ -362,6 +421,5 @@ func Test_Merge_Timeout_3(t *testing.T) {
 	})
 
 	tests.CheckErrorIs(t, context.DeadlineExceeded, err)
-	tests.CheckExpected(t, 0, len(tools.UnhandledErrs()))
-	tests.CheckExpected(t, false, tools.Fs.HasOpenedEntries())
+	tools.CheckReleased(t)
 }
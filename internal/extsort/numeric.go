@@ -0,0 +1,227 @@
+package extsort
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// NumericCompare compares leading numbers like 'sort -n' does: optional blanks, optional '-',
+// digits and optional fraction. Missing or unparsable numbers are equal to zero.
+func NumericCompare(lhs, rhs string) int {
+	return compareParsedNumerics(parseNumeric(lhs), parseNumeric(rhs))
+}
+
+// HumanNumericCompare compares numbers with SI suffixes like 'sort -h' does:
+// first by the sign and the suffix, then by the numeric value.
+func HumanNumericCompare(lhs, rhs string) int {
+	lhsNum := parseNumeric(lhs)
+	rhsNum := parseNumeric(rhs)
+
+	if diff := lhsNum.unitOrder() - rhsNum.unitOrder(); diff != 0 {
+		return sign(diff)
+	}
+
+	return compareParsedNumerics(lhsNum, rhsNum)
+}
+
+// GeneralNumericCompare compares leading floating point numbers like 'sort -g' does.
+// Unparsable values go first, then NaNs, then numbers including infinities.
+func GeneralNumericCompare(lhs, rhs string) int {
+	lhsVal, lhsOk := parseFloatPrefix(lhs)
+	rhsVal, rhsOk := parseFloatPrefix(rhs)
+
+	if !lhsOk || !rhsOk {
+		return compareBools(lhsOk, rhsOk)
+	}
+
+	lhsNan := math.IsNaN(lhsVal)
+	rhsNan := math.IsNaN(rhsVal)
+	if lhsNan || rhsNan {
+		return compareBools(!lhsNan, !rhsNan)
+	}
+
+	if lhsVal < rhsVal {
+		return -1
+	}
+	if lhsVal > rhsVal {
+		return 1
+	}
+	return 0
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+type parsedNumeric struct {
+	negative bool
+	integer  string // without leading zeros
+	fraction string // without trailing zeros
+	suffix   byte
+}
+
+func (this parsedNumeric) isZero() bool {
+	return this.integer == "" && this.fraction == ""
+}
+
+func (this parsedNumeric) unitOrder() int {
+	if this.isZero() {
+		return 0
+	}
+	order := strings.IndexByte(" KMGTPEZYRQ", this.suffix)
+	if this.suffix == 'k' {
+		order = 1
+	}
+	if order < 0 {
+		order = 0
+	}
+	if this.negative {
+		return -order
+	}
+	return order
+}
+
+func parseNumeric(str string) parsedNumeric {
+	result := parsedNumeric{}
+
+	i := skipBlanks(str, 0)
+	if i < len(str) && str[i] == '-' {
+		result.negative = true
+		i++
+	}
+
+	begin := i
+	for i < len(str) && isDigit(str[i]) {
+		i++
+	}
+	result.integer = strings.TrimLeft(str[begin:i], "0")
+
+	if i < len(str) && str[i] == '.' {
+		i++
+		begin = i
+		for i < len(str) && isDigit(str[i]) {
+			i++
+		}
+		result.fraction = strings.TrimRight(str[begin:i], "0")
+	}
+
+	if i < len(str) {
+		result.suffix = str[i]
+	}
+
+	if result.isZero() {
+		result.negative = false
+	}
+
+	return result
+}
+
+func compareParsedNumerics(lhs, rhs parsedNumeric) int {
+	if lhs.negative != rhs.negative {
+		if lhs.negative {
+			return -1
+		}
+		return 1
+	}
+
+	result := len(lhs.integer) - len(rhs.integer)
+	if result == 0 {
+		result = strings.Compare(lhs.integer, rhs.integer)
+	}
+	if result == 0 {
+		result = strings.Compare(lhs.fraction, rhs.fraction)
+	}
+
+	result = sign(result)
+	if lhs.negative {
+		return -result
+	}
+	return result
+}
+
+// parseFloatPrefix parses the longest floating point number at the beginning of the string.
+func parseFloatPrefix(str string) (float64, bool) {
+	begin := skipBlanks(str, 0)
+	i := begin
+	if i < len(str) && (str[i] == '-' || str[i] == '+') {
+		i++
+	}
+
+	hasPrefix := func(prefix string) bool {
+		return len(str)-i >= len(prefix) && strings.EqualFold(str[i:i+len(prefix)], prefix)
+	}
+
+	if hasPrefix("nan") {
+		return math.NaN(), true
+	}
+
+	if hasPrefix("inf") {
+		return math.Inf(1 - 2*strings.Count(str[begin:i], "-")), true
+	}
+
+	digits := 0
+	for i < len(str) && isDigit(str[i]) {
+		i++
+		digits++
+	}
+	if i < len(str) && str[i] == '.' {
+		i++
+		for i < len(str) && isDigit(str[i]) {
+			i++
+			digits++
+		}
+	}
+	if digits == 0 {
+		return 0, false
+	}
+
+	if i < len(str) && (str[i] == 'e' || str[i] == 'E') {
+		j := i + 1
+		if j < len(str) && (str[j] == '-' || str[j] == '+') {
+			j++
+		}
+		if j < len(str) && isDigit(str[j]) {
+			for j < len(str) && isDigit(str[j]) {
+				j++
+			}
+			i = j
+		}
+	}
+
+	val, err := strconv.ParseFloat(str[begin:i], 64)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		return 0, false
+	}
+	return val, true
+}
+
+func skipBlanks(str string, i int) int {
+	for i < len(str) && isBlank(str[i]) {
+		i++
+	}
+	return i
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func sign(val int) int {
+	if val < 0 {
+		return -1
+	}
+	if val > 0 {
+		return 1
+	}
+	return 0
+}
+
+func compareBools(lhs, rhs bool) int {
+	if lhs == rhs {
+		return 0
+	}
+	if lhs {
+		return 1
+	}
+	return -1
+}
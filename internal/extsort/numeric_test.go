@@ -0,0 +1,92 @@
+package extsort
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/kdpdev/extsort/internal/utils/tests"
+)
+
+func checkCompareOrder(t *testing.T, cmp Compare, ordered ...[]string) {
+	flatten := make([]string, 0)
+	for i, group := range ordered {
+		for _, lhs := range group {
+			for _, rhs := range group {
+				tests.CheckExpectedf(t, 0, cmp(lhs, rhs), "'%v' vs '%v'", lhs, rhs)
+			}
+			for _, next := range ordered[i+1:] {
+				for _, rhs := range next {
+					tests.CheckExpectedf(t, -1, cmp(lhs, rhs), "'%v' vs '%v'", lhs, rhs)
+					tests.CheckExpectedf(t, 1, cmp(rhs, lhs), "'%v' vs '%v'", rhs, lhs)
+				}
+			}
+		}
+		flatten = append(flatten, group...)
+	}
+
+	sorted := sort.SliceIsSorted(flatten, func(i, j int) bool {
+		return cmp(flatten[i], flatten[j]) < 0
+	})
+	tests.CheckExpectedf(t, true, sorted, "%v", strings.Join(flatten, "|"))
+}
+
+func Test_NumericCompare(t *testing.T) {
+	checkCompareOrder(t, NumericCompare,
+		[]string{"-100"},
+		[]string{"-3.5", " -3.50x"},
+		[]string{"-0.5"},
+		[]string{"", "0", "-0", "abc", "-", "0.0", "+5"},
+		[]string{"0.01"},
+		[]string{"1e3", "1", "01", "1.", "1.0"},
+		[]string{"9"},
+		[]string{"17"},
+		[]string{"100"},
+		[]string{"12345678901234567890123"},
+	)
+}
+
+func Test_GeneralNumericCompare(t *testing.T) {
+	checkCompareOrder(t, GeneralNumericCompare,
+		[]string{"", "abc", "-", "e5", "."},
+		[]string{"nan", "NaN", "-nan"},
+		[]string{"-inf", "-Infinity"},
+		[]string{"-3.5e2", "-350"},
+		[]string{"-3.5"},
+		[]string{"0", "-0", "0e10", " 0.0"},
+		[]string{"1e-3"},
+		[]string{"9", "9e", "9e+"},
+		[]string{"17"},
+		[]string{"1e3", "+1000"},
+		[]string{"1e400", "inf", "+INF"},
+	)
+}
+
+func Test_HumanNumericCompare(t *testing.T) {
+	checkCompareOrder(t, HumanNumericCompare,
+		[]string{"-1G"},
+		[]string{"-2K", "-2k"},
+		[]string{"-1K"},
+		[]string{"-5"},
+		[]string{"0", "0K", "", "abc"},
+		[]string{"5"},
+		[]string{"1000"},
+		[]string{"0.5K"},
+		[]string{"1K", "1k"},
+		[]string{"12K"},
+		[]string{"1M"},
+		[]string{"1Q"},
+	)
+}
+
+func Test_ParseCompareMode(t *testing.T) {
+	for _, name := range CompareModeNames() {
+		mode, err := ParseCompareMode(name)
+		tests.CheckNotError(t, err)
+		tests.CheckExpected(t, name, mode.String())
+	}
+
+	_, err := ParseCompareMode("unknown")
+	tests.CheckErrorIs(t, ErrBadConfig, err)
+	tests.CheckErrorIs(t, ErrBadConfig, CompareMode(-1).Check())
+}
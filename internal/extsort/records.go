@@ -0,0 +1,198 @@
+package extsort
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// RecordFormat describes how records are framed in input, temp and output files.
+type RecordFormat struct {
+	ZeroTerminated        bool // records are terminated by '\0' instead of '\n'
+	CRLF                  bool // records are terminated by "\r\n", a bare '\n' is accepted on reading
+	KeepMissingTerminator bool // the output ends without terminator if the input does
+	CSV                   bool // terminators inside quoted fields do not end records
+	Header                bool // the first record is kept at the top of the output
+	MaxRecordSize         int  // zero means unlimited
+	FixedSize             int  // non-zero means binary records of the size without terminators
+	LengthPrefix          LengthPrefix
+}
+
+func (this RecordFormat) Check() error {
+	if this.MaxRecordSize < 0 {
+		return fmt.Errorf("%w: MaxRecordSize is negative", ErrBadConfig)
+	}
+
+	if this.ZeroTerminated && this.CRLF {
+		return fmt.Errorf("%w: ZeroTerminated and CRLF are incompatible", ErrBadConfig)
+	}
+
+	if this.FixedSize < 0 {
+		return fmt.Errorf("%w: FixedSize is negative", ErrBadConfig)
+	}
+
+	if err := this.LengthPrefix.Check(); err != nil {
+		return err
+	}
+
+	if this.isBinary() && (this.ZeroTerminated || this.CRLF || this.KeepMissingTerminator || this.CSV) {
+		return fmt.Errorf("%w: binary records have no terminators and CSV", ErrBadConfig)
+	}
+
+	if this.FixedSize > 0 && (this.LengthPrefix != LengthPrefixNone || this.Header) {
+		return fmt.Errorf("%w: FixedSize records have no length prefixes and header", ErrBadConfig)
+	}
+
+	return nil
+}
+
+// Terminator returns the last byte of the serialized terminator, records are split by it on reading.
+func (this RecordFormat) Terminator() byte {
+	if this.ZeroTerminated {
+		return 0
+	}
+	return '\n'
+}
+
+func (this RecordFormat) SerializedTerminator() string {
+	if this.isBinary() {
+		return ""
+	}
+	if this.CRLF {
+		return "\r\n"
+	}
+	return string(this.Terminator())
+}
+
+func (this RecordFormat) isBinary() bool {
+	return this.FixedSize > 0 || this.LengthPrefix != LengthPrefixNone
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// LengthPrefix is the framing of binary records by the prefix with the size of the record.
+type LengthPrefix int
+
+const (
+	LengthPrefixNone LengthPrefix = iota
+	LengthPrefixVarint
+	LengthPrefixUint32LE
+	LengthPrefixUint32BE
+)
+
+var lengthPrefixes = []struct {
+	name   string
+	size   func(recordSize uint64) int
+	append func(buf []byte, recordSize uint64) []byte
+	read   func(r *bufio.Reader) (uint64, error)
+}{
+	LengthPrefixNone: {
+		"none",
+		func(uint64) int { return 0 },
+		func(buf []byte, _ uint64) []byte { return buf },
+		func(*bufio.Reader) (uint64, error) { return 0, io.EOF },
+	},
+	LengthPrefixVarint: {
+		"varint",
+		uvarintSize,
+		binary.AppendUvarint,
+		func(r *bufio.Reader) (uint64, error) { return binary.ReadUvarint(r) },
+	},
+	LengthPrefixUint32LE: {
+		"uint32_le",
+		func(uint64) int { return 4 },
+		func(buf []byte, recordSize uint64) []byte {
+			return binary.LittleEndian.AppendUint32(buf, uint32(recordSize))
+		},
+		func(r *bufio.Reader) (uint64, error) { return readUint32Prefix(r, binary.LittleEndian) },
+	},
+	LengthPrefixUint32BE: {
+		"uint32_be",
+		func(uint64) int { return 4 },
+		func(buf []byte, recordSize uint64) []byte {
+			return binary.BigEndian.AppendUint32(buf, uint32(recordSize))
+		},
+		func(r *bufio.Reader) (uint64, error) { return readUint32Prefix(r, binary.BigEndian) },
+	},
+}
+
+func ParseLengthPrefix(name string) (LengthPrefix, error) {
+	for prefix, p := range lengthPrefixes {
+		if p.name == name {
+			return LengthPrefix(prefix), nil
+		}
+	}
+	return LengthPrefixNone, fmt.Errorf("%w: unknown length prefix '%v'", ErrBadConfig, name)
+}
+
+func (this LengthPrefix) Check() error {
+	if this < 0 || int(this) >= len(lengthPrefixes) {
+		return fmt.Errorf("%w: unknown length prefix %d", ErrBadConfig, int(this))
+	}
+	return nil
+}
+
+func (this LengthPrefix) String() string {
+	if this.Check() != nil {
+		return fmt.Sprintf("LengthPrefix(%d)", int(this))
+	}
+	return lengthPrefixes[this].name
+}
+
+func LengthPrefixNames() []string {
+	names := make([]string, 0, len(lengthPrefixes))
+	for _, p := range lengthPrefixes {
+		names = append(names, p.name)
+	}
+	return names
+}
+
+func uvarintSize(val uint64) int {
+	size := 1
+	for ; val >= 0x80; val >>= 7 {
+		size++
+	}
+	return size
+}
+
+func readUint32Prefix(r *bufio.Reader, order binary.ByteOrder) (uint64, error) {
+	buf := [4]byte{}
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return 0, err
+	}
+	return uint64(order.Uint32(buf[:])), nil
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// terminatorTracker remembers whether the data read so far ends with the terminator.
+type terminatorTracker struct {
+	reader         io.Reader
+	terminator     byte
+	hasTerminators bool
+	isEmpty        bool
+	terminated     bool
+}
+
+func newTerminatorTracker(reader io.Reader, format RecordFormat) *terminatorTracker {
+	return &terminatorTracker{
+		reader:         reader,
+		terminator:     format.Terminator(),
+		hasTerminators: format.SerializedTerminator() != "",
+		isEmpty:        true,
+	}
+}
+
+func (this *terminatorTracker) Read(p []byte) (int, error) {
+	n, err := this.reader.Read(p)
+	if n > 0 {
+		this.isEmpty = false
+		this.terminated = p[n-1] == this.terminator
+	}
+	return n, err
+}
+
+func (this *terminatorTracker) MissingTerminator() bool {
+	return this.hasTerminators && !this.isEmpty && !this.terminated
+}
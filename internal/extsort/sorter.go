@@ -0,0 +1,408 @@
+package extsort
+
+import (
+	"bufio"
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/kdpdev/extsort/internal/utils/misc"
+)
+
+// SorterOptions configures Sorter. Chunks are spilled to OutputDir, the directory must exist
+// and must not be used by other sorts at the same time.
+type SorterOptions struct {
+	SplittingOptions
+	MaxOpenFiles int // files merged by the iterator at once, zero means DefaultMaxOpenFiles
+}
+
+func NewDefaultSorterOptions() SorterOptions {
+	return SorterOptions{
+		SplittingOptions: SplittingOptions{
+			OutputDir:          GetDefaultTempDir(),
+			ChunkCapacity:      DefaultChunkCapacity,
+			PreferredChunkSize: DefaultPreferredChunkSizeKb * 1024,
+			ReadBufSize:        DefaultWorkerReadBufSizeKb * 1024,
+			WriteBufSize:       DefaultWorkerWriteBufSizeKb * 1024,
+			WorkersCount:       GetDefaultWorkersCount(),
+		},
+		MaxOpenFiles: DefaultMaxOpenFiles,
+	}
+}
+
+func (this SorterOptions) Check() error {
+	if this.OutputDir == "" {
+		return fmt.Errorf("%w: OutputDir is not specified", ErrBadConfig)
+	}
+
+	if this.ChunkCapacity < 0 {
+		return fmt.Errorf("%w: ChunkCapacity is negative", ErrBadConfig)
+	}
+
+	if this.PreferredChunkSize <= 0 {
+		return fmt.Errorf("%w: PreferredChunkSize is negative or zero", ErrBadConfig)
+	}
+
+	if this.ReadBufSize < 0 || this.WriteBufSize < 0 {
+		return fmt.Errorf("%w: buffer size is negative", ErrBadConfig)
+	}
+
+	if this.WorkersCount <= 0 {
+		return fmt.Errorf("%w: WorkersCount is negative or zero", ErrBadConfig)
+	}
+
+	if this.MaxOpenFiles < 0 || this.MaxOpenFiles == 1 {
+		return fmt.Errorf("%w: MaxOpenFiles must be zero or at least 2", ErrBadConfig)
+	}
+
+	return nil
+}
+
+func (this SorterOptions) mergeOptions() MergeOptions {
+	return MergeOptions{
+		OutputDir:           this.OutputDir,
+		WriteBufSize:        this.WriteBufSize,
+		ReadBufSize:         this.ReadBufSize,
+		WorkersCount:        this.WorkersCount,
+		Compare:             this.Compare,
+		Unique:              this.Unique,
+		Framing:             this.Framing,
+		Compress:            this.Compress,
+		OnDuplicatesRemoved: this.OnDuplicatesRemoved,
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Sorter sorts records pushed one by one. Full chunks are sorted and spilled in the background,
+// Add blocks while all workers are busy. Add and Close must not be called concurrently.
+type Sorter struct {
+	baseCtx    context.Context
+	opts       SorterOptions
+	sortChunk  func(ctx context.Context, chunk StringsChunk) (string, error)
+	spiller    *chunksSpiller
+	chunk      StringsChunk
+	chunkFiles []string
+	records    int
+	closed     bool
+}
+
+func NewSorter(ctx context.Context, opts SorterOptions) (*Sorter, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := opts.Check(); err != nil {
+		return nil, err
+	}
+
+	opts.Compare = CompareOrDefault(opts.Compare)
+	opts.Framing = FramingOrDefault(opts.Framing)
+	if opts.MaxOpenFiles == 0 {
+		opts.MaxOpenFiles = DefaultMaxOpenFiles
+	}
+
+	ctx = WithCallerScope(ctx)
+
+	this := &Sorter{
+		baseCtx:   ctx,
+		opts:      opts,
+		sortChunk: makeChunksSorter(opts.SplittingOptions),
+		spiller:   newChunksSpiller(ctx, opts.WorkersCount),
+	}
+	this.chunk = this.newChunk()
+
+	return this, nil
+}
+
+// Add returns the error of a failed spill, the sorter is unusable after it.
+func (this *Sorter) Add(record string) error {
+	if this.closed {
+		return os.ErrClosed
+	}
+
+	if err := this.spiller.ctx.Err(); err != nil {
+		this.spiller.fail(err)
+		return this.spiller.getErr()
+	}
+
+	this.records++
+	if this.opts.CheckRecord != nil {
+		if err := this.opts.CheckRecord(record); err != nil {
+			err = fmt.Errorf("record #%v: %w", this.records, err)
+			this.spiller.fail(err)
+			return err
+		}
+	}
+
+	this.chunk.Add(record)
+	if this.chunk.SerializedDataSize() >= this.opts.PreferredChunkSize {
+		return this.spill()
+	}
+
+	return nil
+}
+
+// Close spills the rest of records and waits for all spills.
+func (this *Sorter) Close() error {
+	if this.closed {
+		return this.spiller.getErr()
+	}
+	this.closed = true
+
+	// at least 1 chunk is produced (even if it is empty), nothing is spilled after a failure
+	if this.spiller.getErr() == nil && (this.chunk.Len() > 0 || this.spiller.seq == 0) {
+		this.spiller.fail(this.spill())
+	}
+
+	chunkFiles, err := this.spiller.close()
+	this.chunkFiles = chunkFiles
+	return err
+}
+
+// Sorted merges the spilled chunks lazily, the sorter must be closed successfully.
+// The chunk files are owned by the returned iterator, so Sorted can be called only once.
+func (this *Sorter) Sorted() (*SortedRecords, error) {
+	if !this.closed {
+		return nil, fmt.Errorf("%w: the sorter is not closed", os.ErrInvalid)
+	}
+
+	if err := this.spiller.getErr(); err != nil {
+		return nil, err
+	}
+
+	if this.chunkFiles == nil {
+		return nil, ErrNoFiles
+	}
+
+	files := this.chunkFiles
+	this.chunkFiles = nil
+
+	return newSortedRecords(this.baseCtx, files, this.opts)
+}
+
+func (this *Sorter) newChunk() StringsChunk {
+	return NewArrStringsChunkWithFraming(this.opts.ChunkCapacity, this.opts.Framing)
+}
+
+func (this *Sorter) spill() error {
+	chunk := this.chunk
+	this.chunk = this.newChunk()
+	return this.spiller.spill(func(ctx context.Context) (string, error) {
+		return this.sortChunk(ctx, chunk)
+	})
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// SortedRecords is the k-way merge of sorted files: for it.Next() { use(it.Record()) }, then check it.Err().
+// The files are removed by Close.
+type SortedRecords struct {
+	ctx        context.Context
+	cmp        Compare
+	unique     bool
+	filePaths  []string
+	files      []io.Closer
+	sources    mergeHeap
+	record     string
+	hasRecord  bool
+	duplicates int
+	err        error
+
+	onDuplicatesRemoved func(count int)
+}
+
+func newSortedRecords(ctx context.Context, filePaths []string, opts SorterOptions) (_ *SortedRecords, err error) {
+	this := &SortedRecords{
+		ctx:                 ctx,
+		cmp:                 opts.Compare,
+		unique:              opts.Unique,
+		filePaths:           filePaths,
+		sources:             mergeHeap{cmp: makeKeyedCompare(RecordKey{}, opts.Compare)},
+		onDuplicatesRemoved: opts.OnDuplicatesRemoved,
+	}
+	defer misc.InvokeIfError(&err, func() {
+		if e := this.Close(); e != nil {
+			OnUnhandledError(ctx, e)
+		}
+	})
+
+	this.filePaths, err = reduceFiles(ctx, this.filePaths, opts.MaxOpenFiles, opts.mergeOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	fs := GetFs(ctx)
+	for idx, filePath := range this.filePaths {
+		file, _, e := fs.OpenReadFile(filePath)
+		if e != nil {
+			return nil, e
+		}
+		decompressor := newTempFileReader(ctx, file, opts.Compress)
+		this.files = append(this.files, file, decompressor)
+
+		source := &mergeSource{
+			reader: opts.Framing.NewReader(bufio.NewReaderSize(decompressor, opts.ReadBufSize)),
+			idx:    idx,
+		}
+		hasRecord, e := source.next()
+		if e != nil {
+			return nil, e
+		}
+		if hasRecord {
+			this.sources.items = append(this.sources.items, source)
+		}
+	}
+	heap.Init(&this.sources)
+
+	return this, nil
+}
+
+func (this *SortedRecords) Next() bool {
+	for this.err == nil && len(this.sources.items) > 0 {
+		if this.err = this.ctx.Err(); this.err != nil {
+			return false
+		}
+
+		top := this.sources.items[0]
+		record := top.record
+
+		hasRecord, err := top.next()
+		if err != nil {
+			this.err = err
+			return false
+		}
+		if hasRecord {
+			heap.Fix(&this.sources, 0)
+		} else {
+			heap.Pop(&this.sources)
+		}
+
+		if this.unique && this.hasRecord && this.cmp(this.record, record) == 0 {
+			this.duplicates++
+			continue
+		}
+
+		this.record = record
+		this.hasRecord = true
+		return true
+	}
+
+	return false
+}
+
+func (this *SortedRecords) Record() string {
+	return this.record
+}
+
+func (this *SortedRecords) Err() error {
+	return this.err
+}
+
+// Close closes and removes the merged files.
+func (this *SortedRecords) Close() (err error) {
+	onceErr := misc.NewOnceError(&err)
+	onceErr = misc.NewOnceEventWithNotSetNotification(onceErr, GetContextedUnhandledErrorHandler(this.ctx))
+
+	for _, file := range this.files {
+		onceErr.Invoke(file.Close)
+	}
+	this.files = nil
+	this.sources.items = nil
+
+	fs := GetFs(this.ctx)
+	for _, filePath := range this.filePaths {
+		onceErr.Invoke(func() error { return fs.Remove(filePath) })
+	}
+	this.filePaths = nil
+
+	if this.duplicates > 0 && this.onDuplicatesRemoved != nil {
+		this.onDuplicatesRemoved(this.duplicates)
+		this.duplicates = 0
+	}
+
+	return err
+}
+
+// reduceFiles merges adjacent files until there are no more than maxFiles of them,
+// the merging of adjacent files keeps the stability.
+func reduceFiles(ctx context.Context, filePaths []string, maxFiles int, opts MergeOptions) ([]string, error) {
+	getMergedFilePath := misc.MakeSequencedStringsGen(filepath.Join(opts.OutputDir, "reduced_%06v"))
+	for len(filePaths) > maxFiles {
+		reduced := make([]string, 0, (len(filePaths)+1)/2)
+		for i := 0; i < len(filePaths); i += 2 {
+			if i+1 == len(filePaths) {
+				reduced = append(reduced, filePaths[i])
+				continue
+			}
+
+			mergedFilePath := getMergedFilePath()
+			if err := MergeFiles(ctx, opts, filePaths[i], filePaths[i+1], mergedFilePath); err != nil {
+				return append(reduced, filePaths[i:]...), err
+			}
+			reduced = append(reduced, mergedFilePath)
+		}
+		filePaths = reduced
+	}
+	return filePaths, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// mergeSource holds the head record of the reader with its key extracted by the extract if it is set.
+type mergeSource struct {
+	reader  RecordReader
+	extract func(record string) any
+	record  string
+	key     any
+	idx     int
+}
+
+func (this *mergeSource) next() (bool, error) {
+	record, err := this.reader.ReadRecord()
+	if errors.Is(err, io.EOF) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	this.record = record
+	if this.extract != nil {
+		this.key = this.extract(record)
+	}
+	return true, nil
+}
+
+// mergeHeap takes records of earlier sources first on ties.
+type mergeHeap struct {
+	items []*mergeSource
+	cmp   keyedCompare
+}
+
+func (this *mergeHeap) Len() int {
+	return len(this.items)
+}
+
+func (this *mergeHeap) Less(i, j int) bool {
+	lhs, rhs := this.items[i], this.items[j]
+	result := this.cmp.compare(lhs.record, lhs.key, rhs.record, rhs.key)
+	return result < 0 || (result == 0 && lhs.idx < rhs.idx)
+}
+
+func (this *mergeHeap) Swap(i, j int) {
+	this.items[i], this.items[j] = this.items[j], this.items[i]
+}
+
+func (this *mergeHeap) Push(x any) {
+	this.items = append(this.items, x.(*mergeSource))
+}
+
+func (this *mergeHeap) Pop() any {
+	last := this.items[len(this.items)-1]
+	this.items = this.items[:len(this.items)-1]
+	return last
+}
@@ -0,0 +1,134 @@
+package extsort
+
+import (
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/kdpdev/extsort/internal/utils/tests"
+)
+
+func newTestSorter(t *testing.T, tools *TestTools, opts SorterOptions) *Sorter {
+	opts.OutputDir = tools.SplittingOpts.OutputDir
+	opts.WorkersCount = 2
+	opts.ChunkCapacity = 16
+	opts.PreferredChunkSize = 64
+	sorter, err := NewSorter(tools.Ctx, opts)
+	tests.CheckNotError(t, err)
+	return sorter
+}
+
+func collectSorted(t *testing.T, sorter *Sorter) []string {
+	it, err := sorter.Sorted()
+	tests.CheckNotError(t, err)
+
+	records := make([]string, 0)
+	for it.Next() {
+		records = append(records, it.Record())
+	}
+	tests.CheckNotError(t, it.Err())
+	tests.CheckNotError(t, it.Close())
+	return records
+}
+
+func Test_Sorter(t *testing.T) {
+	for _, maxOpenFiles := range []int{0, 2, 3} {
+		tools := NewTestTools(t)
+		sorter := newTestSorter(t, tools, SorterOptions{MaxOpenFiles: maxOpenFiles})
+
+		expected := make([]string, 0, 500)
+		for i := 0; i < 500; i++ {
+			tests.CheckNotError(t, sorter.Add(strconv.Itoa(499-i)))
+			expected = append(expected, strconv.Itoa(i))
+		}
+		tests.CheckNotError(t, sorter.Close())
+		tests.CheckErrorIs(t, os.ErrClosed, sorter.Add("x"))
+
+		records := collectSorted(t, sorter)
+		sort.Strings(expected)
+		tests.CheckExpectedf(t, strings.Join(expected, "|"), strings.Join(records, "|"), "max open files %v", maxOpenFiles)
+
+		_, err := sorter.Sorted()
+		tests.CheckErrorIs(t, ErrNoFiles, err)
+
+		tools.CheckReleased(t)
+		tests.CheckNotError(t, tools.CheckAbsent(tools.SplittingOpts.OutputDir+"/chunk_000001"))
+	}
+}
+
+func Test_Sorter_UniqueStable(t *testing.T) {
+	tools := NewTestTools(t)
+
+	removed := atomic.Int64{}
+	cmp := MakeKeysCompare([]Key{{StartField: 1, EndField: 1}}, ",", nil)
+	sorter := newTestSorter(t, tools, SorterOptions{
+		SplittingOptions: SplittingOptions{Compare: cmp, Stable: true, Unique: true, OnDuplicatesRemoved: func(count int) { removed.Add(int64(count)) }},
+	})
+
+	for i := 0; i < 100; i++ {
+		tests.CheckNotError(t, sorter.Add(strconv.Itoa(i%3)+","+strconv.Itoa(i)))
+	}
+	tests.CheckNotError(t, sorter.Close())
+
+	tests.CheckExpected(t, "0,0|1,1|2,2", strings.Join(collectSorted(t, sorter), "|"))
+	tests.CheckExpected(t, int64(97), removed.Load())
+}
+
+func Test_Sorter_Errors(t *testing.T) {
+	tools := NewTestTools(t)
+
+	_, err := NewSorter(tools.Ctx, SorterOptions{})
+	tests.CheckErrorIs(t, ErrBadConfig, err)
+
+	opts := NewDefaultSorterOptions()
+	tests.CheckNotError(t, opts.Check())
+	tests.CheckExpected(t, DefaultMaxOpenFiles, opts.MaxOpenFiles)
+	opts.PreferredChunkSize = 0
+	tests.CheckErrorIs(t, ErrBadConfig, opts.Check())
+	opts = NewDefaultSorterOptions()
+	opts.WorkersCount = 0
+	tests.CheckErrorIs(t, ErrBadConfig, opts.Check())
+
+	sorter := newTestSorter(t, tools, SorterOptions{})
+	_, err = sorter.Sorted()
+	tests.CheckErrorIs(t, os.ErrInvalid, err)
+
+	sorter = newTestSorter(t, tools, SorterOptions{
+		SplittingOptions: SplittingOptions{CheckRecord: func(record string) error {
+			if record == "bad" {
+				return ErrBadRecord
+			}
+			return nil
+		}},
+	})
+	for i := 0; i < 100; i++ {
+		tests.CheckNotError(t, sorter.Add(strconv.Itoa(i)))
+	}
+	tests.CheckErrorIs(t, ErrBadRecord, sorter.Add("bad"))
+	tests.CheckErrorIs(t, ErrBadRecord, sorter.Close())
+	_, err = sorter.Sorted()
+	tests.CheckErrorIs(t, ErrBadRecord, err)
+
+	tests.CheckNotError(t, tools.CheckAbsent(tools.SplittingOpts.OutputDir+"/chunk_000001"))
+	tools.CheckReleased(t)
+}
+
+func Test_Sorter_SpillError(t *testing.T) {
+	tools := NewTestTools(t)
+	tests.CheckNotError(t, tools.CreateFile(tools.SplittingOpts.OutputDir+"/chunk_000001", ""))
+
+	sorter := newTestSorter(t, tools, SorterOptions{})
+	err := error(nil)
+	for i := 0; i < 1000 && err == nil; i++ {
+		err = sorter.Add(strconv.Itoa(i))
+	}
+	tests.CheckErrorIs(t, os.ErrExist, err)
+	tests.CheckErrorIs(t, os.ErrExist, sorter.Close())
+	tests.CheckErrorIs(t, os.ErrExist, sorter.Close())
+
+	tests.CheckNotError(t, tools.CheckAbsent(tools.SplittingOpts.OutputDir+"/chunk_000002"))
+	tools.CheckReleased(t)
+}
@@ -3,6 +3,7 @@ package extsort
 import (
 	"bufio"
 	"context"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
@@ -18,6 +19,24 @@ type SplittingOptions struct {
 	WriteBufSize       int
 	ReadBufSize        int
 	WorkersCount       int
+	Compare            Compare
+	RecordKey          RecordKey // replaces Compare if not empty, the key is extracted once per record
+	Unique             bool
+	Stable             bool
+	Framing            RecordFraming             // nil means newline terminated lines
+	CheckRecord        func(record string) error // optional, fails the splitting on the first bad record
+	ChunkFilePrefix    string                    // "chunk" if empty, distinguishes splits sharing the OutputDir
+	Compress           bool                      // chunk files are compressed by flate at the TempCompressionLevel
+
+	OnDuplicatesRemoved func(count int)
+}
+
+// recordsCompare returns the compare of records which takes the RecordKey into account.
+func (this SplittingOptions) recordsCompare() Compare {
+	if this.RecordKey.IsEmpty() {
+		return this.Compare
+	}
+	return this.RecordKey.MakeCompare()
 }
 
 type SplittingProgressListener func(ctx context.Context, chunk StringsChunk, filePath string) error
@@ -71,11 +90,10 @@ func SplitStreamToSortedChunks(
 	onceErr = misc.NewOnceEventWithGuard(onceErr, guard)
 	onceErr = misc.NewOnceEventWithNotSetNotification(onceErr, GetContextedUnhandledErrorHandler(ctx))
 
-	saveChunk := makeChunksSaver(opts.OutputDir, opts.WriteBufSize)
+	sortAndSaveChunk := makeChunksSorter(opts)
 
-	handleChunk := func(ctx context.Context, chunk StringsChunk) {
-		chunk.Sort()
-		filePath, e := saveChunk(ctx, chunk)
+	handleChunk := func(ctx context.Context, chunk StringsChunk, seq int) {
+		filePath, e := sortAndSaveChunk(ctx, chunk)
 
 		if e == nil {
 			e = updateProgress(ctx, chunk, filePath)
@@ -90,26 +108,38 @@ func SplitStreamToSortedChunks(
 
 		guard.Lock()
 		defer guard.Unlock()
-		chunkFilePaths = append(chunkFilePaths, filePath)
+		for len(chunkFilePaths) <= seq {
+			chunkFilePaths = append(chunkFilePaths, "")
+		}
+		chunkFilePaths[seq] = filePath // keeps the input order of chunks
 	}
 
 	enumErr := func() error { // because of the 'defer onceErr.Invoke(chunksProc.Close)', it waits all tasks
 		chunksProc := misc.NewAsyncProcessor(opts.WorkersCount)
 		defer onceErr.Invoke(chunksProc.Close)
 		inputFileReader := bufio.NewReaderSize(inputStream, opts.ReadBufSize)
-		return EnumChunks(
+		seq := 0
+		return enumChunks(
 			ctx,
 			inputFileReader,
 			opts.PreferredChunkSize,
 			opts.ChunkCapacity,
+			opts.Framing,
+			opts.CheckRecord,
 			func(ctx context.Context, chunk StringsChunk) error {
-				return chunksProc.Exec(func() { handleChunk(ctx, chunk) })
+				chunkSeq := seq
+				seq++
+				return chunksProc.Exec(func() { handleChunk(ctx, chunk, chunkSeq) })
 			})
 	}()
 
 	onceErr.TrySet(enumErr)
 
-	return chunkFilePaths, err
+	if err != nil {
+		return removeEmptyStrings(chunkFilePaths), err
+	}
+
+	return chunkFilePaths, nil
 }
 
 func EnumChunks(
@@ -117,6 +147,19 @@ func EnumChunks(
 	source io.Reader,
 	preferredChunkSize int,
 	chunkCapacity int,
+	framing RecordFraming,
+	consume func(ctx context.Context, chunk StringsChunk) error) error {
+
+	return enumChunks(ctx, source, preferredChunkSize, chunkCapacity, framing, nil, consume)
+}
+
+func enumChunks(
+	ctx context.Context,
+	source io.Reader,
+	preferredChunkSize int,
+	chunkCapacity int,
+	framing RecordFraming,
+	checkRecord func(record string) error,
 	consume func(ctx context.Context, chunk StringsChunk) error) error {
 
 	if err := ctx.Err(); err != nil {
@@ -127,14 +170,21 @@ func EnumChunks(
 		return os.ErrInvalid
 	}
 
-	newChunk := func() StringsChunk { return NewArrStringsChunk(chunkCapacity) }
+	framing = FramingOrDefault(framing)
+	newChunk := func() StringsChunk { return NewArrStringsChunkWithFraming(chunkCapacity, framing) }
 
 	ctx = WithCallerScope(ctx)
 
 	firstChunk := newChunk()
 	chunk := firstChunk
-	nextLine := NewSyncLinesGenFromReader(ctx, source)
-	_, err := EnumLines(nextLine, func(line string) error {
+	recordsCount := 0
+	_, err := EnumRecords(ctx, framing.NewReader(source), func(line string) error {
+		recordsCount++
+		if checkRecord != nil {
+			if e := checkRecord(line); e != nil {
+				return fmt.Errorf("record #%v: %w", recordsCount, e)
+			}
+		}
 		chunk.Add(line)
 		if chunk.SerializedDataSize() >= preferredChunkSize {
 			e := consume(ctx, chunk)
@@ -155,9 +205,112 @@ func EnumChunks(
 	return nil
 }
 
-func makeChunksSaver(rootDir string, writeBufSize int) func(ctx context.Context, chunk StringsChunk) (string, error) {
-	filePathFmt := filepath.Join(rootDir, "chunk_%06v")
-	filesPathsGen := misc.MakeSequencedStringsGen(filePathFmt)
+func makeChunksSorter(opts SplittingOptions) func(ctx context.Context, chunk StringsChunk) (string, error) {
+	saveChunk := makeChunksSaver(opts.OutputDir, opts.ChunkFilePrefix, opts.WriteBufSize, opts.Compress)
+	return func(ctx context.Context, chunk StringsChunk) (string, error) {
+		stable := opts.Stable || opts.Unique // the unique sort keeps the first of equal records
+		if !opts.RecordKey.IsEmpty() {
+			chunk.SortByKey(opts.RecordKey, stable)
+		} else if stable {
+			chunk.StableSort(opts.Compare)
+		} else {
+			chunk.Sort(opts.Compare)
+		}
+
+		if opts.Unique {
+			removed := chunk.Unique(opts.recordsCompare())
+			if removed > 0 && opts.OnDuplicatesRemoved != nil {
+				opts.OnDuplicatesRemoved(removed)
+			}
+		}
+
+		return saveChunk(ctx, chunk)
+	}
+}
+
+// chunksSpiller saves chunks by background workers and keeps the chunk files in the order of spills.
+// A failed save cancels the spiller context, the files are removed by close on any error.
+type chunksSpiller struct {
+	ctx        context.Context
+	cancel     context.CancelFunc
+	proc       misc.Processor
+	guard      *sync.RWMutex
+	err        error
+	onceErr    misc.OnceError
+	chunkFiles []string
+	seq        int
+}
+
+func newChunksSpiller(ctx context.Context, workersCount int) *chunksSpiller {
+	ctx = WithUnhandledErrorContextErrorsFilter(ctx)
+	ctx, cancel := context.WithCancel(ctx)
+
+	this := &chunksSpiller{
+		ctx:    ctx,
+		cancel: cancel,
+		proc:   misc.NewAsyncProcessor(workersCount),
+		guard:  &sync.RWMutex{},
+	}
+	this.onceErr = misc.NewOnceError(&this.err)
+	this.onceErr = misc.NewOnceEventWithGuard(this.onceErr, this.guard)
+	this.onceErr = misc.NewOnceEventWithNotSetNotification(this.onceErr, GetContextedUnhandledErrorHandler(ctx))
+	return this
+}
+
+// spill blocks while all workers are busy, it returns the first error of the spiller.
+func (this *chunksSpiller) spill(save func(ctx context.Context) (string, error)) error {
+	seq := this.seq
+	this.seq++
+
+	err := this.proc.Exec(func() {
+		filePath, e := save(this.ctx)
+		if e != nil {
+			this.fail(e)
+			return
+		}
+
+		this.guard.Lock()
+		defer this.guard.Unlock()
+		for len(this.chunkFiles) <= seq {
+			this.chunkFiles = append(this.chunkFiles, "")
+		}
+		this.chunkFiles[seq] = filePath // keeps the input order of chunks
+	})
+	if err != nil {
+		return err
+	}
+
+	return this.onceErr.Get()
+}
+
+func (this *chunksSpiller) fail(err error) {
+	if this.onceErr.TrySet(err) {
+		this.cancel()
+	}
+}
+
+func (this *chunksSpiller) getErr() error {
+	return this.onceErr.Get()
+}
+
+// close waits for all spills and returns the chunk files.
+func (this *chunksSpiller) close() ([]string, error) {
+	this.onceErr.Invoke(this.proc.Close)
+	this.cancel()
+
+	chunkFiles := this.chunkFiles
+	this.chunkFiles = nil
+
+	if err := this.onceErr.Get(); err != nil {
+		removeFiles(this.ctx, removeEmptyStrings(chunkFiles))
+		return nil, err
+	}
+
+	return chunkFiles, nil
+}
+
+func makeChunksSaver(rootDir string, prefix string, writeBufSize int, compress bool) func(ctx context.Context, chunk StringsChunk) (string, error) {
+	filesPathsGen := makeChunkFilePathsGen(rootDir, prefix)
 	return func(ctx context.Context, chunk StringsChunk) (filePath string, err error) {
 		onceErr := misc.NewOnceError(&err)
 		onceErr = misc.NewOnceEventWithNotSetNotification(onceErr, GetContextedUnhandledErrorHandler(ctx))
@@ -171,7 +324,8 @@ func makeChunksSaver(rootDir string, writeBufSize int) func(ctx context.Context,
 
 		defer onceErr.Invoke(writer.Close)
 
-		bufferedWriter := bufio.NewWriterSize(writer, writeBufSize)
+		compressor := newTempFileWriter(ctx, writer, compress)
+		bufferedWriter := bufio.NewWriterSize(compressor, writeBufSize)
 		size, err := chunk.Write(bufferedWriter)
 		if err != nil {
 			return "", err
@@ -182,6 +336,11 @@ func makeChunksSaver(rootDir string, writeBufSize int) func(ctx context.Context,
 			return "", err
 		}
 
+		err = compressor.Close()
+		if err != nil {
+			return "", err
+		}
+
 		if size != chunk.SerializedDataSize() {
 			return "", ErrUnexpectedWrittenBytesCount
 		}
@@ -189,3 +348,140 @@ func makeChunksSaver(rootDir string, writeBufSize int) func(ctx context.Context,
 		return filePath, err
 	}
 }
+
+func makeChunkFilePathsGen(rootDir string, prefix string) func() string {
+	if prefix == "" {
+		prefix = "chunk"
+	}
+	return misc.MakeSequencedStringsGen(filepath.Join(rootDir, prefix+"_%06v"))
+}
+
+// copySortedStream copies records of the already sorted input to a single chunk file, it replaces
+// the splitting in the merge-only mode. If checkSorted is set, a record out of order fails the copying
+// with ErrNotSorted, the input name and the line number (records are counted from the firstLine).
+func copySortedStream(
+	ctx context.Context,
+	inputStream io.Reader,
+	inputName string,
+	firstLine int,
+	checkSorted bool,
+	opts SplittingOptions,
+	updateProgress SplittingProgressListener) (chunkFilePath string, err error) {
+
+	if err = ctx.Err(); err != nil {
+		return "", err
+	}
+
+	if updateProgress == nil {
+		updateProgress = func(ctx context.Context, chunk StringsChunk, filePath string) error { return nil }
+	}
+
+	ctx = WithCallerScope(ctx)
+	fs := GetFs(ctx)
+
+	onceErr := misc.NewOnceError(&err)
+	onceErr = misc.NewOnceEventWithNotSetNotification(onceErr, GetContextedUnhandledErrorHandler(ctx))
+
+	filePath := makeChunkFilePathsGen(opts.OutputDir, opts.ChunkFilePrefix)()
+	file, err := fs.CreateWriteFile(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer misc.InvokeIfError(&err, func() {
+		if e := fs.Remove(filePath); e != nil {
+			OnUnhandledError(ctx, e)
+		}
+	})
+	defer onceErr.Invoke(file.Close)
+
+	cmp := makeKeyedCompare(opts.RecordKey, opts.Compare)
+	framing := FramingOrDefault(opts.Framing)
+	compressor := newTempFileWriter(ctx, file, opts.Compress)
+	writer := bufio.NewWriterSize(compressor, opts.WriteBufSize)
+	chunk := NewArrStringsChunkWithFraming(opts.ChunkCapacity, framing)
+
+	writeChunk := func() error {
+		if _, e := chunk.Write(writer); e != nil {
+			return e
+		}
+		e := updateProgress(ctx, chunk, filePath)
+		chunk = NewArrStringsChunkWithFraming(opts.ChunkCapacity, framing)
+		return e
+	}
+
+	duplicates := 0
+	defer func() {
+		if duplicates > 0 && opts.OnDuplicatesRemoved != nil {
+			opts.OnDuplicatesRemoved(duplicates)
+		}
+	}()
+
+	prev := keyedRecord{}
+	hasPrevRecord := false
+	recordsCount := 0
+	_, err = EnumRecords(ctx, framing.NewReader(inputStream), func(record string) error {
+		recordsCount++
+		if opts.CheckRecord != nil {
+			if e := opts.CheckRecord(record); e != nil {
+				return fmt.Errorf("record #%v: %w", recordsCount, e)
+			}
+		}
+
+		key := cmp.extract(record)
+		if hasPrevRecord {
+			result := cmp.compare(prev.record, prev.key, record, key)
+			if checkSorted && result > 0 {
+				return fmt.Errorf("%w: '%v' line %v", ErrNotSorted, inputName, firstLine+recordsCount-1)
+			}
+			if opts.Unique && result == 0 {
+				duplicates++
+				return nil
+			}
+		}
+		prev = keyedRecord{record: record, key: key}
+		hasPrevRecord = true
+
+		chunk.Add(record)
+		if chunk.SerializedDataSize() >= opts.PreferredChunkSize {
+			return writeChunk()
+		}
+		return nil
+	})
+
+	if err == nil && chunk.Len() > 0 {
+		err = writeChunk()
+	}
+
+	if err == nil {
+		err = writer.Flush()
+	}
+
+	if err == nil {
+		err = compressor.Close()
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return filePath, nil
+}
+
+func removeEmptyStrings(strs []string) []string {
+	result := strs[:0]
+	for _, s := range strs {
+		if s != "" {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+func removeFiles(ctx context.Context, filePaths []string) {
+	fs := GetFs(ctx)
+	for _, filePath := range filePaths {
+		if err := fs.Remove(filePath); err != nil {
+			OnUnhandledError(ctx, err)
+		}
+	}
+}
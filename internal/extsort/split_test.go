@@ -17,7 +17,7 @@ func Test_EnumChunks(t *testing.T) {
 
 	buf := bytes.NewBufferString("")
 	chunks := make([]StringsChunk, 0)
-	err := EnumChunks(ctx, buf, 0, 0, func(ctx context.Context, chunk StringsChunk) error {
+	err := EnumChunks(ctx, buf, 0, 0, nil, func(ctx context.Context, chunk StringsChunk) error {
 		tests.CheckExpected(t, 0, chunk.Len())
 		chunks = append(chunks, chunk)
 		return nil
@@ -27,7 +27,7 @@ func Test_EnumChunks(t *testing.T) {
 
 	buf = bytes.NewBufferString("\n")
 	chunks = make([]StringsChunk, 0)
-	err = EnumChunks(ctx, buf, 0, 0, func(ctx context.Context, chunk StringsChunk) error {
+	err = EnumChunks(ctx, buf, 0, 0, nil, func(ctx context.Context, chunk StringsChunk) error {
 		tests.CheckExpected(t, 1, chunk.Len())
 		chunks = append(chunks, chunk)
 		return nil
@@ -37,7 +37,7 @@ func Test_EnumChunks(t *testing.T) {
 
 	buf = bytes.NewBufferString("1")
 	chunks = make([]StringsChunk, 0)
-	err = EnumChunks(ctx, buf, 0, 0, func(ctx context.Context, chunk StringsChunk) error {
+	err = EnumChunks(ctx, buf, 0, 0, nil, func(ctx context.Context, chunk StringsChunk) error {
 		tests.CheckExpected(t, 1, chunk.Len())
 		chunks = append(chunks, chunk)
 		return nil
@@ -47,7 +47,7 @@ func Test_EnumChunks(t *testing.T) {
 
 	buf = bytes.NewBufferString("1\n2")
 	chunks = make([]StringsChunk, 0)
-	err = EnumChunks(ctx, buf, 0, 0, func(ctx context.Context, chunk StringsChunk) error {
+	err = EnumChunks(ctx, buf, 0, 0, nil, func(ctx context.Context, chunk StringsChunk) error {
 		tests.CheckExpected(t, 1, chunk.Len())
 		chunks = append(chunks, chunk)
 		return nil
@@ -60,7 +60,7 @@ func Test_EnumChunks_Cancel_1(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel()
 	buf := bytes.NewBufferString("abc")
-	err := EnumChunks(ctx, buf, 0, 0, func(ctx context.Context, chunk StringsChunk) error {
+	err := EnumChunks(ctx, buf, 0, 0, nil, func(ctx context.Context, chunk StringsChunk) error {
 		return fmt.Errorf("unexpected")
 	})
 	tests.CheckErrorIs(t, context.Canceled, err)
@@ -81,7 +81,7 @@ func Test_EnumChunks_Cancel_2(t *testing.T) {
 	defer cancelTimer.Stop()
 
 	buf := bytes.NewBufferString("1\n2\n3\n4\n5\n6\n7\n8\n9\n")
-	err := EnumChunks(ctx, buf, 0, 0, func(ctx context.Context, chunk StringsChunk) error {
+	err := EnumChunks(ctx, buf, 0, 0, nil, func(ctx context.Context, chunk StringsChunk) error {
 		return tools.Sleep(ctx, tools.Quantum)
 	})
 	tests.CheckErrorIs(t, context.Canceled, err)
@@ -94,7 +94,7 @@ func Test_EnumChunks_Timeout_1(t *testing.T) {
 	defer cancel()
 	<-ctx.Done()
 	buf := bytes.NewBufferString("abc")
-	err := EnumChunks(ctx, buf, 0, 0, func(ctx context.Context, chunk StringsChunk) error {
+	err := EnumChunks(ctx, buf, 0, 0, nil, func(ctx context.Context, chunk StringsChunk) error {
 		return fmt.Errorf("unexpected")
 	})
 	tests.CheckErrorIs(t, context.DeadlineExceeded, err)
@@ -112,7 +112,7 @@ func Test_EnumChunks_Timeout_2(t *testing.T) {
 	defer cancel()
 
 	buf := bytes.NewBufferString("1\n2\n3\n4\n5\n6\n7\n8\n9\n")
-	err := EnumChunks(ctx, buf, 0, 0, func(ctx context.Context, chunk StringsChunk) error {
+	err := EnumChunks(ctx, buf, 0, 0, nil, func(ctx context.Context, chunk StringsChunk) error {
 		return tools.Sleep(ctx, tools.Quantum)
 	})
 	tests.CheckErrorIs(t, context.DeadlineExceeded, err)
@@ -123,8 +123,7 @@ func Test_SplitFile_1(t *testing.T) {
 
 	_, err := SplitFileToSortedChunks(tools.Ctx, "input", tools.SplittingOpts, nil)
 	tests.CheckErrorIs(t, os.ErrNotExist, err)
-	tests.CheckExpected(t, 0, len(tools.UnhandledErrs()))
-	tests.CheckExpected(t, false, tools.Fs.HasOpenedEntries())
+	tools.CheckReleased(t)
 }
 
 func Test_SplitFile_2(t *testing.T) {
@@ -233,6 +232,31 @@ func Test_SplitFile_5(t *testing.T) {
 	tests.CheckExpected(t, false, tools.Fs.HasOpenedEntries())
 }
 
+func Test_SplitFile_Order(t *testing.T) {
+	tools := NewTestTools(t)
+
+	linesCount := 10
+	tools.SplittingOpts.PreferredChunkSize = 2
+	tools.SplittingOpts.WorkersCount = 4
+
+	tests.CheckNotError(t, tools.CreateFile("input", tools.GetLinesForSplitting(linesCount)))
+	files, err := SplitFileToSortedChunks(tools.Ctx, "input", tools.SplittingOpts, nil)
+	tests.CheckNotError(t, err)
+	tests.CheckExpected(t, linesCount, len(files))
+
+	for i, f := range files {
+		chunk, _, err := tools.Fs.OpenReadFile(f)
+		tests.CheckNotError(t, err)
+		lines, err := CollectLines(NewSyncLinesGenFromReader(tools.Ctx, chunk))
+		tests.CheckNotError(t, err)
+		tests.CheckNotError(t, chunk.Close())
+		tests.CheckExpected(t, 1, len(lines))
+		tests.CheckExpected(t, fmt.Sprint(linesCount-i-1), lines[0])
+	}
+
+	tools.CheckReleased(t)
+}
+
 func Test_SplitFile_Cancel_1(t *testing.T) {
 	tools := NewTestTools(t)
 
@@ -243,8 +267,7 @@ func Test_SplitFile_Cancel_1(t *testing.T) {
 	})
 
 	tests.CheckErrorIs(t, context.Canceled, err)
-	tests.CheckExpected(t, 0, len(tools.UnhandledErrs()))
-	tests.CheckExpected(t, false, tools.Fs.HasOpenedEntries())
+	tools.CheckReleased(t)
 }
 
 func Test_SplitFile_Cancel_2(t *testing.T) {
@@ -260,8 +283,7 @@ func Test_SplitFile_Cancel_2(t *testing.T) {
 	})
 
 	tests.CheckErrorIs(t, context.Canceled, err)
-	tests.CheckExpected(t, 0, len(tools.UnhandledErrs()))
-	tests.CheckExpected(t, false, tools.Fs.HasOpenedEntries())
+	tools.CheckReleased(t)
 }
 
 func Test_SplitFile_Cancel_3(t *testing.T) {
@@ -285,8 +307,7 @@ func Test_SplitFile_Cancel_3(t *testing.T) {
 	})
 
 	tests.CheckErrorIs(t, context.Canceled, err)
-	tests.CheckExpected(t, 0, len(tools.UnhandledErrs()))
-	tests.CheckExpected(t, false, tools.Fs.HasOpenedEntries())
+	tools.CheckReleased(t)
 }
 
 func Test_SplitFile_Timeout_1(t *testing.T) {
@@ -301,8 +322,7 @@ func Test_SplitFile_Timeout_1(t *testing.T) {
 	})
 
 	tests.CheckErrorIs(t, context.DeadlineExceeded, err)
-	tests.CheckExpected(t, 0, len(tools.UnhandledErrs()))
-	tests.CheckExpected(t, false, tools.Fs.HasOpenedEntries())
+	tools.CheckReleased(t)
 }
 
 func Test_SplitFile_Timeout_2(t *testing.T) {
@@ -320,8 +340,7 @@ func Test_SplitFile_Timeout_2(t *testing.T) {
 	})
 
 	tests.CheckErrorIs(t, context.DeadlineExceeded, err)
-	tests.CheckExpected(t, 0, len(tools.UnhandledErrs()))
-	tests.CheckExpected(t, false, tools.Fs.HasOpenedEntries())
+	tools.CheckReleased(t)
 }
 
 func Test_SplitFile_Timeout_3(t *testing.T) {
@@ -343,6 +362,5 @@ func Test_SplitFile_Timeout_3(t *testing.T) {
 	})
 
 	tests.CheckErrorIs(t, context.DeadlineExceeded, err)
-	tests.CheckExpected(t, 0, len(tools.UnhandledErrs()))
-	tests.CheckExpected(t, false, tools.Fs.HasOpenedEntries())
+	tools.CheckReleased(t)
 }
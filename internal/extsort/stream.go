@@ -0,0 +1,571 @@
+package extsort
+
+import (
+	"bufio"
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/kdpdev/extsort/internal/extsort/env"
+	"github.com/kdpdev/extsort/internal/utils/alg"
+	"github.com/kdpdev/extsort/internal/utils/misc"
+)
+
+// SortStream sorts records of the reader into the writer, only chunks and intermediate merges
+// are stored in the TempDir. The InputFilePath and OutputFilePath of the config are ignored.
+func SortStream(ctx context.Context, r io.Reader, w io.Writer, cfg Config) (err error) {
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+
+	if err = cfg.CheckSorting(); err != nil {
+		return err
+	}
+
+	ctx = WithCallerScope(ctx)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	open := func(ctx context.Context, idx int) (io.ReadCloser, error) { return io.NopCloser(r), nil }
+	split, err := splitInputs(ctx, []string{"stream"}, open, &cfg, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer misc.InvokeIfError(&err, func() { closeSortedInputs(ctx, split.sortedInputs) })
+
+	return writeMerged(ctx, w, split, cfg, cfg.mergeOptions(split.compare, nil), nil)
+}
+
+// splitResult is what the merging needs to know about the split input. In the MergeOnly mode
+// the inputs are not split but opened, the sortedInputs are merged directly to the output.
+type splitResult struct {
+	chunkFiles        []string
+	sortedInputs      []*sortedInput
+	header            string
+	hasHeader         bool
+	missingTerminator bool
+	compare           Compare
+}
+
+// isMissingTerminator is known for the sortedInputs only after they are merged.
+func (this splitResult) isMissingTerminator() bool {
+	if len(this.sortedInputs) > 0 {
+		return this.sortedInputs[len(this.sortedInputs)-1].input.MissingTerminator()
+	}
+	return this.missingTerminator
+}
+
+// sortedInput is an opened input of the MergeOnly mode, firstLine is the line number of its first record.
+type sortedInput struct {
+	name      string
+	file      io.Closer
+	input     *terminatorTracker
+	reader    *bufio.Reader
+	firstLine int
+}
+
+// splitInputs splits the inputs in parallel, the chunks keep the order of inputs. The header of
+// the first input resolves key names of the config, headers of other inputs must be the same.
+// In the MergeOnly mode the inputs are opened to be merged directly, each of them is copied to
+// a single chunk as is only if there are more inputs than DefaultMaxOpenFiles.
+func splitInputs(
+	ctx context.Context,
+	inputNames []string,
+	open func(ctx context.Context, idx int) (io.ReadCloser, error),
+	cfg *Config,
+	onDuplicatesRemoved func(count int),
+	updateProgress SplittingProgressListener) (result splitResult, err error) {
+
+	if cfg.MergeOnly && len(inputNames) <= DefaultMaxOpenFiles {
+		return openSortedInputs(ctx, inputNames, open, cfg)
+	}
+
+	ctx = WithUnhandledErrorContextErrorsFilter(ctx)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	onceErr := misc.NewOnceError(&err)
+	onceErr = misc.NewOnceEventWithGuard(onceErr, &sync.RWMutex{})
+	onceErr = misc.NewOnceEventWithNotSetNotification(onceErr, GetContextedUnhandledErrorHandler(ctx))
+
+	first, err := open(ctx, 0)
+	if err != nil {
+		return result, err
+	}
+	defer onceErr.Invoke(first.Close)
+
+	firstInput := newTerminatorTracker(first, cfg.RecordFormat)
+	firstReader := bufio.NewReaderSize(firstInput, cfg.WorkerReadBufSize)
+
+	result.header, result.hasHeader, err = readHeaderAndResolveKeys(firstReader, cfg)
+	if err != nil {
+		return result, err
+	}
+
+	result.compare = cfg.GetCompare()
+
+	inputsCount := len(inputNames)
+	parallelism := alg.Max(alg.Min(inputsCount, cfg.WorkersCount), 1)
+	opts := cfg.splittingOptions(result.compare, onDuplicatesRemoved)
+	opts.WorkersCount = alg.Max(opts.WorkersCount/parallelism, 1)
+
+	chunkFiles := make([][]string, inputsCount)
+	inputs := make([]*terminatorTracker, inputsCount)
+
+	splitOne := func(idx int) (e error) {
+		input, reader := firstInput, firstReader
+		if idx > 0 {
+			file, e := open(ctx, idx)
+			if e != nil {
+				return e
+			}
+			defer onceErr.Invoke(file.Close)
+
+			input = newTerminatorTracker(file, cfg.RecordFormat)
+			reader = bufio.NewReaderSize(input, cfg.WorkerReadBufSize)
+
+			if e = skipHeader(reader, *cfg, result.header, result.hasHeader); e != nil {
+				return fmt.Errorf("input #%v: %w", idx, e)
+			}
+		}
+
+		inputOpts := opts
+		if inputsCount > 1 {
+			inputOpts.ChunkFilePrefix = fmt.Sprintf("chunk_%06v", idx)
+		}
+
+		inputs[idx] = input
+
+		if !cfg.MergeOnly {
+			chunkFiles[idx], e = SplitStreamToSortedChunks(ctx, reader, inputOpts, updateProgress)
+			return e
+		}
+
+		firstLine := 1
+		if cfg.RecordFormat.Header {
+			firstLine = 2
+		}
+		chunkFile, e := copySortedStream(ctx, reader, inputNames[idx], firstLine, cfg.CheckSorted, inputOpts, updateProgress)
+		if e != nil {
+			return e
+		}
+		chunkFiles[idx] = []string{chunkFile}
+		return nil
+	}
+
+	execErr := func() error { // waits all tasks because of the 'defer onceErr.Invoke(proc.Close)'
+		proc := misc.NewAsyncProcessor(parallelism)
+		defer onceErr.Invoke(proc.Close)
+		for idx := 0; idx < inputsCount; idx++ {
+			e := proc.Exec(func() {
+				if e := splitOne(idx); e != nil && onceErr.TrySet(e) {
+					cancel()
+				}
+			})
+			if e != nil {
+				return e
+			}
+		}
+		return nil
+	}()
+	onceErr.TrySet(execErr)
+
+	if err != nil {
+		for _, files := range chunkFiles {
+			removeFiles(ctx, files)
+		}
+		return result, err
+	}
+
+	for _, files := range chunkFiles {
+		result.chunkFiles = append(result.chunkFiles, files...)
+	}
+	result.missingTerminator = inputs[len(inputs)-1].MissingTerminator()
+
+	return result, nil
+}
+
+// openSortedInputs opens the inputs one by one, the header of the first input resolves key names
+// of the config, headers of other inputs must be the same.
+func openSortedInputs(
+	ctx context.Context,
+	inputNames []string,
+	open func(ctx context.Context, idx int) (io.ReadCloser, error),
+	cfg *Config) (result splitResult, err error) {
+
+	defer misc.InvokeIfError(&err, func() { closeSortedInputs(ctx, result.sortedInputs) })
+
+	firstLine := 1
+	if cfg.RecordFormat.Header {
+		firstLine = 2
+	}
+
+	for idx, inputName := range inputNames {
+		file, e := open(ctx, idx)
+		if e != nil {
+			return result, e
+		}
+
+		input := newTerminatorTracker(file, cfg.RecordFormat)
+		reader := bufio.NewReaderSize(input, cfg.WorkerReadBufSize)
+		result.sortedInputs = append(result.sortedInputs, &sortedInput{
+			name:      inputName,
+			file:      file,
+			input:     input,
+			reader:    reader,
+			firstLine: firstLine,
+		})
+
+		if idx == 0 {
+			result.header, result.hasHeader, e = readHeaderAndResolveKeys(reader, cfg)
+		} else if e = skipHeader(reader, *cfg, result.header, result.hasHeader); e != nil {
+			e = fmt.Errorf("input #%v: %w", idx, e)
+		}
+		if e != nil {
+			return result, e
+		}
+	}
+
+	result.compare = cfg.GetCompare()
+	return result, nil
+}
+
+func closeSortedInputs(ctx context.Context, inputs []*sortedInput) {
+	for _, input := range inputs {
+		if input.file == nil {
+			continue
+		}
+		if err := input.file.Close(); err != nil {
+			OnUnhandledError(ctx, err)
+		}
+		input.file = nil
+	}
+}
+
+// skipHeader reads the header of a not first input, it must be the same as the header of the first one.
+func skipHeader(reader *bufio.Reader, cfg Config, firstHeader string, firstHasHeader bool) error {
+	if !cfg.RecordFormat.Header {
+		return nil
+	}
+
+	header, err := cfg.GetFraming().NewReader(reader).ReadRecord()
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if firstHasHeader && header != firstHeader {
+		return fmt.Errorf("%w: the header differs from the header of the first input", ErrBadRecord)
+	}
+
+	return nil
+}
+
+// writeMerged writes the header and the merge of split chunks into the writer,
+// the missing last terminator of the input is kept missing if the format requires.
+func writeMerged(ctx context.Context, w io.Writer, split splitResult, cfg Config, opts MergeOptions,
+	updateProgress MergingProgressListener) (err error) {
+
+	tail := &tailHoldingWriter{writer: w}
+	if cfg.RecordFormat.KeepMissingTerminator {
+		tail.size = len(cfg.RecordFormat.SerializedTerminator())
+	}
+	output := bufio.NewWriterSize(tail, cfg.WorkerWriteBufSize)
+
+	if split.hasHeader {
+		if _, err = cfg.GetFraming().NewWriter(output).WriteRecord(split.header); err != nil {
+			return err
+		}
+	}
+
+	if split.sortedInputs != nil {
+		err = mergeSortedInputs(ctx, split.sortedInputs, cfg, opts, output)
+	} else {
+		err = mergeToWriter(ctx, split.chunkFiles, opts, output, updateProgress)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tail.Finish(!split.isMissingTerminator())
+}
+
+// mergeSortedInputs is the k-way merge of the MergeOnly inputs into the writer, the inputs are closed.
+// If the config requires CheckSorted, a record out of order fails the merge with ErrNotSorted,
+// the input name and the line number.
+func mergeSortedInputs(ctx context.Context, inputs []*sortedInput, cfg Config, opts MergeOptions, out *bufio.Writer) (err error) {
+	onceErr := misc.NewOnceError(&err)
+	onceErr = misc.NewOnceEventWithNotSetNotification(onceErr, GetContextedUnhandledErrorHandler(ctx))
+
+	for _, input := range inputs {
+		defer onceErr.Invoke(func() error {
+			file := input.file
+			input.file = nil
+			return file.Close()
+		})
+	}
+
+	cmp := makeKeyedCompare(opts.RecordKey, opts.Compare)
+	framing := FramingOrDefault(opts.Framing)
+	checkRecord := cfg.GetRecordCheck()
+	recordsCounts := make([]int, len(inputs))
+
+	readNext := func(source *mergeSource) (bool, error) {
+		hasRecord, e := source.next()
+		if e != nil || !hasRecord {
+			return false, e
+		}
+		recordsCounts[source.idx]++
+		if checkRecord != nil {
+			if e = checkRecord(source.record); e != nil {
+				return false, fmt.Errorf("'%v' record #%v: %w", inputs[source.idx].name, recordsCounts[source.idx], e)
+			}
+		}
+		return true, nil
+	}
+
+	sources := mergeHeap{cmp: cmp}
+	for idx, input := range inputs {
+		source := &mergeSource{reader: framing.NewReader(input.reader), extract: opts.RecordKey.Extract, idx: idx}
+		hasRecord, e := readNext(source)
+		if e != nil {
+			return e
+		}
+		if hasRecord {
+			sources.items = append(sources.items, source)
+		}
+	}
+	heap.Init(&sources)
+
+	duplicates := 0
+	defer func() {
+		if duplicates > 0 && opts.OnDuplicatesRemoved != nil {
+			opts.OnDuplicatesRemoved(duplicates)
+		}
+	}()
+
+	writer := framing.NewWriter(out)
+	last := keyedRecord{}
+	hasLast := false
+	for len(sources.items) > 0 {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		top := sources.items[0]
+		current := keyedRecord{record: top.record, key: top.key}
+
+		hasRecord, e := readNext(top)
+		if e != nil {
+			return e
+		}
+		if hasRecord {
+			if cfg.CheckSorted && cmp.compare(current.record, current.key, top.record, top.key) > 0 {
+				input := inputs[top.idx]
+				return fmt.Errorf("%w: '%v' line %v", ErrNotSorted, input.name, input.firstLine+recordsCounts[top.idx]-1)
+			}
+			heap.Fix(&sources, 0)
+		} else {
+			heap.Pop(&sources)
+		}
+
+		if opts.Unique && hasLast && cmp.compare(last.record, last.key, current.record, current.key) == 0 {
+			duplicates++
+			continue
+		}
+		last = current
+		hasLast = true
+
+		if _, err = writer.WriteRecord(current.record); err != nil {
+			return err
+		}
+	}
+
+	return out.Flush()
+}
+
+// mergeToWriter merges both halves of files by concurrent Merges and streams the final merge into the writer.
+func mergeToWriter(ctx context.Context, files []string, opts MergeOptions, out *bufio.Writer,
+	updateProgress MergingProgressListener) (err error) {
+	if len(files) == 0 {
+		return ErrNoFiles
+	}
+
+	fs := GetFs(ctx)
+
+	if len(files) == 1 {
+		return copyFileToWriter(ctx, files[0], opts.Compress, out)
+	}
+
+	leftFilePath, rightFilePath, err := mergeHalves(ctx, files, opts, updateProgress)
+	if err != nil {
+		return err
+	}
+
+	onceErr := misc.NewOnceError(&err)
+	onceErr = misc.NewOnceEventWithNotSetNotification(onceErr, GetContextedUnhandledErrorHandler(ctx))
+
+	left, _, err := fs.OpenReadFile(leftFilePath)
+	if err != nil {
+		removeFiles(ctx, []string{leftFilePath, rightFilePath})
+		return err
+	}
+	defer onceErr.Invoke(func() error { return closeAndRemove(fs, left, leftFilePath) })
+
+	right, _, err := fs.OpenReadFile(rightFilePath)
+	if err != nil {
+		removeFiles(ctx, []string{rightFilePath})
+		return err
+	}
+	defer onceErr.Invoke(func() error { return closeAndRemove(fs, right, rightFilePath) })
+
+	leftDecompressor := newTempFileReader(ctx, left, opts.Compress)
+	rightDecompressor := newTempFileReader(ctx, right, opts.Compress)
+	leftReader := bufio.NewReaderSize(leftDecompressor, opts.ReadBufSize)
+	rightReader := bufio.NewReaderSize(rightDecompressor, opts.ReadBufSize)
+
+	if err = MergeStreams(ctx, opts, leftReader, rightReader, out); err != nil {
+		return err
+	}
+
+	if err = errors.Join(leftDecompressor.Close(), rightDecompressor.Close()); err != nil {
+		return err
+	}
+
+	if updateProgress != nil {
+		return updateProgress(ctx, StdioFilePath, leftFilePath, rightFilePath)
+	}
+
+	return nil
+}
+
+// mergeHalves merges both halves of files at the same time, the merged files are named by the
+// "left" and "right" prefixes. The halves share the workers, a failed Merge cancels the other one,
+// the merged file of which is removed.
+func mergeHalves(ctx context.Context, files []string, opts MergeOptions,
+	updateProgress MergingProgressListener) (leftFilePath, rightFilePath string, err error) {
+
+	ctx = WithUnhandledErrorContextErrorsFilter(ctx)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	onceErr := misc.NewOnceError(&err)
+	onceErr = misc.NewOnceEventWithGuard(onceErr, &sync.RWMutex{})
+	onceErr = misc.NewOnceEventWithNotSetNotification(onceErr, GetContextedUnhandledErrorHandler(ctx))
+
+	mergeHalf := func(files []string, prefix string, result *string) {
+		halfOpts := opts
+		halfOpts.FilePrefix = prefix
+		halfOpts.WorkersCount = alg.Max(opts.WorkersCount/2, 1)
+		mergedFilePath, e := Merge(ctx, files, halfOpts, updateProgress)
+		if e != nil {
+			if onceErr.TrySet(e) {
+				cancel()
+			}
+			return
+		}
+		*result = mergedFilePath
+	}
+
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		mergeHalf(files[len(files)/2:], "right", &rightFilePath)
+	}()
+	mergeHalf(files[:len(files)/2], "left", &leftFilePath)
+	wg.Wait()
+
+	if err = onceErr.Get(); err != nil {
+		removeFiles(ctx, removeEmptyStrings([]string{leftFilePath, rightFilePath}))
+		return "", "", err
+	}
+
+	return leftFilePath, rightFilePath, nil
+}
+
+func copyFileToWriter(ctx context.Context, filePath string, compressed bool, out *bufio.Writer) (err error) {
+	fs := GetFs(ctx)
+	onceErr := misc.NewOnceError(&err)
+	onceErr = misc.NewOnceEventWithNotSetNotification(onceErr, GetContextedUnhandledErrorHandler(ctx))
+
+	file, _, err := fs.OpenReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	defer onceErr.Invoke(func() error { return closeAndRemove(fs, file, filePath) })
+
+	decompressor := newTempFileReader(ctx, file, compressed)
+	if _, err = io.Copy(out, decompressor); err != nil {
+		return err
+	}
+
+	if err = decompressor.Close(); err != nil {
+		return err
+	}
+
+	return out.Flush()
+}
+
+func closeAndRemove(fs env.Fs, file io.Closer, filePath string) error {
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return fs.Remove(filePath)
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// tailHoldingWriter holds the last size bytes back until Finish decides whether to write them.
+type tailHoldingWriter struct {
+	writer io.Writer
+	size   int
+	tail   []byte
+}
+
+func (this *tailHoldingWriter) Write(p []byte) (int, error) {
+	if this.size == 0 {
+		return this.writer.Write(p)
+	}
+
+	if len(p) >= this.size {
+		if err := this.writeAll(this.tail, p[:len(p)-this.size]); err != nil {
+			return 0, err
+		}
+		this.tail = append(this.tail[:0], p[len(p)-this.size:]...)
+		return len(p), nil
+	}
+
+	this.tail = append(this.tail, p...)
+	if extra := len(this.tail) - this.size; extra > 0 {
+		if err := this.writeAll(this.tail[:extra]); err != nil {
+			return 0, err
+		}
+		this.tail = append(this.tail[:0], this.tail[extra:]...)
+	}
+	return len(p), nil
+}
+
+func (this *tailHoldingWriter) Finish(writeTail bool) error {
+	if !writeTail {
+		return nil
+	}
+	return this.writeAll(this.tail)
+}
+
+func (this *tailHoldingWriter) writeAll(parts ...[]byte) error {
+	for _, part := range parts {
+		if len(part) == 0 {
+			continue
+		}
+		if _, err := this.writer.Write(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package extsort
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/kdpdev/extsort/internal/utils/tests"
+)
+
+func Test_SortStream(t *testing.T) {
+	for _, linesCount := range []int{0, 1, 10, 2000} {
+		tools, cfg := newExtSortTools(t)
+		cfg.PreferredChunkSize = 1024
+
+		lines := make([]string, 0, linesCount)
+		for i := 0; i < linesCount; i++ {
+			lines = append(lines, strconv.Itoa(linesCount-i))
+		}
+		input := strings.Join(lines, "\n")
+
+		out := &bytes.Buffer{}
+		tests.CheckNotErrorf(t, SortStream(tools.Ctx, strings.NewReader(input), out, cfg), "lines %v", linesCount)
+
+		sort.Strings(lines)
+		expected := strings.Join(lines, "\n")
+		if linesCount > 0 {
+			expected += "\n"
+		}
+		tests.CheckExpectedf(t, expected, out.String(), "lines %v", linesCount)
+
+		tools.CheckReleased(t)
+		tests.CheckNotError(t, tools.CheckAbsent(cfg.TempDir+"/left_000001"))
+		tests.CheckNotError(t, tools.CheckAbsent(cfg.TempDir+"/right_000001"))
+	}
+}
+
+func Test_SortStream_MergeHalvesError(t *testing.T) {
+	tools := NewTestTools(t)
+	opts := tools.MergingOpts
+
+	files := make([]string, 0, 4)
+	for i := 0; i < 4; i++ {
+		file := "file" + strconv.Itoa(i)
+		tests.CheckNotError(t, tools.CreateFile(file, strconv.Itoa(i)+"\n"))
+		files = append(files, file)
+	}
+
+	failRight := func(ctx context.Context, out, left, right string) error {
+		if strings.HasPrefix(filepath.Base(out), "right") {
+			return ErrBadRecord
+		}
+		return nil
+	}
+
+	out := bufio.NewWriter(&bytes.Buffer{})
+	tests.CheckErrorIs(t, ErrBadRecord, mergeToWriter(tools.Ctx, files, opts, out, failRight))
+	tests.CheckNotError(t, tools.CheckAbsent(opts.OutputDir+"/left_000001"))
+	tests.CheckNotError(t, tools.CheckAbsent(opts.OutputDir+"/right_000001"))
+
+	tools.CheckReleased(t)
+}
+
+func Test_SortStream_Format(t *testing.T) {
+	tools, cfg := newExtSortTools(t)
+	cfg.PreferredChunkSize = 16
+	cfg.RecordFormat = RecordFormat{CRLF: true, Header: true, KeepMissingTerminator: true}
+	cfg.Keys, _ = ParseKeys("[n]n")
+	cfg.Unique = true
+
+	out := &bytes.Buffer{}
+	input := "name n\r\nc 3\r\nb 2\r\na 1\r\nb 2\r\nd 10\r\ne 2\r\nf 02"
+	tests.CheckNotError(t, SortStream(tools.Ctx, strings.NewReader(input), out, cfg))
+	tests.CheckExpected(t, "name n\r\na 1\r\nb 2\r\nc 3\r\nd 10", out.String())
+
+	out.Reset()
+	tests.CheckNotError(t, SortStream(tools.Ctx, strings.NewReader(input+"\r\n"), out, cfg))
+	tests.CheckExpected(t, "name n\r\na 1\r\nb 2\r\nc 3\r\nd 10\r\n", out.String())
+
+	cfg.TempDir = ""
+	tests.CheckErrorIs(t, ErrBadConfig, SortStream(tools.Ctx, strings.NewReader(input), out, cfg))
+
+	tools.CheckReleased(t)
+}
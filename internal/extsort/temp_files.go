@@ -0,0 +1,177 @@
+package extsort
+
+import (
+	"compress/flate"
+	"context"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// TempCompressionLevel is the flate level of compressed temp files, the speed matters more than the ratio.
+const TempCompressionLevel = flate.BestSpeed
+
+// TempFilesStats describes chunks and merged files written to the TempDir. Sizes are cumulative over
+// all the written files, every merge level writes the data again, so they are not the peak disk space.
+type TempFilesStats struct {
+	DataSize      uint64        // uncompressed bytes
+	FilesSize     uint64        // bytes written to files
+	CodecDuration time.Duration // the compression and the decompression without the I/O, summed over workers
+	IODuration    time.Duration // writes and reads of files, summed over workers
+}
+
+// CompressionRatio is DataSize/FilesSize, it is 1 for uncompressed temp files.
+func (this TempFilesStats) CompressionRatio() float64 {
+	if this.FilesSize == 0 {
+		return 1
+	}
+	return float64(this.DataSize) / float64(this.FilesSize)
+}
+
+type tempFilesStatsCollector struct {
+	dataSize      atomic.Uint64
+	filesSize     atomic.Uint64
+	codecDuration atomic.Int64
+	ioDuration    atomic.Int64
+}
+
+func (this *tempFilesStatsCollector) add(dataSize, filesSize uint64, codecDuration, ioDuration time.Duration) {
+	if this == nil {
+		return
+	}
+	this.dataSize.Add(dataSize)
+	this.filesSize.Add(filesSize)
+	this.codecDuration.Add(int64(codecDuration))
+	this.ioDuration.Add(int64(ioDuration))
+}
+
+func (this *tempFilesStatsCollector) stats() TempFilesStats {
+	return TempFilesStats{
+		DataSize:      this.dataSize.Load(),
+		FilesSize:     this.filesSize.Load(),
+		CodecDuration: time.Duration(this.codecDuration.Load()),
+		IODuration:    time.Duration(this.ioDuration.Load()),
+	}
+}
+
+func WithTempFilesStatsCollector(ctx context.Context) (context.Context, func() TempFilesStats) {
+	collector := &tempFilesStatsCollector{}
+	return context.WithValue(ctx, contextKeyTempFilesStats, collector), collector.stats
+}
+
+func getTempFilesStatsCollector(ctx context.Context) *tempFilesStatsCollector {
+	return getContextValue[*tempFilesStatsCollector](ctx, contextKeyTempFilesStats, nil)
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// newTempFileWriter compresses data written to the temp file if compress is set.
+// Close flushes the compressor and does not close the file.
+func newTempFileWriter(ctx context.Context, file io.Writer, compress bool) io.WriteCloser {
+	this := &tempFileWriter{
+		stats: getTempFilesStatsCollector(ctx),
+		file:  &timedWriter{writer: file},
+	}
+	if compress {
+		this.compressor, _ = flate.NewWriter(this.file, TempCompressionLevel) // the level is valid
+	}
+	return this
+}
+
+type tempFileWriter struct {
+	stats      *tempFilesStatsCollector
+	file       *timedWriter
+	compressor *flate.Writer
+	dataSize   uint64
+	duration   time.Duration
+}
+
+func (this *tempFileWriter) Write(p []byte) (n int, err error) {
+	if this.compressor == nil {
+		n, err = this.file.Write(p)
+	} else {
+		begin := time.Now()
+		n, err = this.compressor.Write(p)
+		this.duration += time.Since(begin)
+	}
+	this.dataSize += uint64(n)
+	return n, err
+}
+
+func (this *tempFileWriter) Close() (err error) {
+	codecDuration := time.Duration(0)
+	if this.compressor != nil {
+		begin := time.Now()
+		err = this.compressor.Close()
+		this.duration += time.Since(begin)
+		codecDuration = this.duration - this.file.duration
+	}
+	this.stats.add(this.dataSize, this.file.written, codecDuration, this.file.duration)
+	return err
+}
+
+// newTempFileReader decompresses data of the temp file if compress is set. Close does not close the file.
+func newTempFileReader(ctx context.Context, file io.Reader, compress bool) io.ReadCloser {
+	this := &tempFileReader{
+		stats: getTempFilesStatsCollector(ctx),
+		file:  &timedReader{reader: file},
+	}
+	if compress {
+		this.decompressor = flate.NewReader(this.file)
+	}
+	return this
+}
+
+type tempFileReader struct {
+	stats        *tempFilesStatsCollector
+	file         *timedReader
+	decompressor io.ReadCloser
+	duration     time.Duration
+}
+
+func (this *tempFileReader) Read(p []byte) (int, error) {
+	if this.decompressor == nil {
+		return this.file.Read(p)
+	}
+	begin := time.Now()
+	n, err := this.decompressor.Read(p)
+	this.duration += time.Since(begin)
+	return n, err
+}
+
+func (this *tempFileReader) Close() error {
+	if this.decompressor == nil {
+		this.stats.add(0, 0, 0, this.file.duration)
+		return nil
+	}
+	this.stats.add(0, 0, this.duration-this.file.duration, this.file.duration)
+	return this.decompressor.Close()
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+type timedWriter struct {
+	writer   io.Writer
+	written  uint64
+	duration time.Duration
+}
+
+func (this *timedWriter) Write(p []byte) (int, error) {
+	begin := time.Now()
+	n, err := this.writer.Write(p)
+	this.duration += time.Since(begin)
+	this.written += uint64(n)
+	return n, err
+}
+
+type timedReader struct {
+	reader   io.Reader
+	duration time.Duration
+}
+
+func (this *timedReader) Read(p []byte) (int, error) {
+	begin := time.Now()
+	n, err := this.reader.Read(p)
+	this.duration += time.Since(begin)
+	return n, err
+}
@@ -0,0 +1,108 @@
+package extsort
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/kdpdev/extsort/internal/utils/tests"
+)
+
+func Test_TempFiles_Compress(t *testing.T) {
+	tools := NewTestTools(t)
+	ctx, getStats := WithTempFilesStatsCollector(tools.Ctx)
+
+	lines := make([]string, 0, 3000)
+	for i := 0; i < 3000; i++ {
+		lines = append(lines, fmt.Sprintf("%08v some compressible text", 3000-i))
+	}
+	input := strings.Join(lines, "\n") + "\n"
+
+	splittingOpts := tools.SplittingOpts
+	splittingOpts.ChunkCapacity = 256
+	splittingOpts.PreferredChunkSize = 16 * 1024
+	splittingOpts.Compress = true
+	chunkFiles, err := SplitStreamToSortedChunks(ctx, strings.NewReader(input), splittingOpts, nil)
+	tests.CheckNotError(t, err)
+
+	stats := getStats()
+	tests.CheckExpected(t, uint64(len(input)), stats.DataSize)
+	tests.CheckExpected(t, true, stats.FilesSize < stats.DataSize/2)
+
+	mergingOpts := tools.MergingOpts
+	mergingOpts.Compress = true
+	mergedFilePath, err := Merge(ctx, chunkFiles, mergingOpts, nil)
+	tests.CheckNotError(t, err)
+
+	mergedFile, mergedFileSize, err := tools.Fs.OpenReadFile(mergedFilePath)
+	tests.CheckNotError(t, err)
+	tests.CheckExpected(t, true, mergedFileSize < uint64(len(input))/2)
+	decompressor := newTempFileReader(ctx, mergedFile, true)
+	merged, err := io.ReadAll(decompressor)
+	tests.CheckNotError(t, err)
+	tests.CheckNotError(t, decompressor.Close())
+	tests.CheckNotError(t, mergedFile.Close())
+
+	sort.Strings(lines)
+	tests.CheckExpected(t, strings.Join(lines, "\n")+"\n", string(merged))
+
+	stats = getStats()
+	tests.CheckExpected(t, true, stats.DataSize > uint64(len(input)))
+	tests.CheckExpected(t, true, stats.CompressionRatio() > 2)
+	tests.CheckExpected(t, true, stats.CodecDuration > 0)
+	tests.CheckExpected(t, true, stats.IODuration > 0)
+
+	tools.CheckReleased(t)
+}
+
+func Test_TempFiles_CompressedSorter(t *testing.T) {
+	tools := NewTestTools(t)
+	sorter := newTestSorter(t, tools, SorterOptions{MaxOpenFiles: 2, SplittingOptions: SplittingOptions{Compress: true}})
+
+	expected := make([]string, 0, 500)
+	for i := 0; i < 500; i++ {
+		tests.CheckNotError(t, sorter.Add(strconv.Itoa(499-i)))
+		expected = append(expected, strconv.Itoa(i))
+	}
+	tests.CheckNotError(t, sorter.Close())
+
+	sort.Strings(expected)
+	tests.CheckExpected(t, strings.Join(expected, "|"), strings.Join(collectSorted(t, sorter), "|"))
+
+	tools.CheckReleased(t)
+}
+
+func Test_ExtSort_CompressTempFiles(t *testing.T) {
+	for _, outputFilePath := range []string{"output", StdioFilePath} {
+		tools, cfg := newExtSortTools(t)
+		cfg.OutputFilePath = outputFilePath
+		cfg.ChunkCapacity = 1024
+		cfg.PreferredChunkSize = 1024
+		cfg.RecordFormat = RecordFormat{Header: true, KeepMissingTerminator: true}
+		cfg.CompressTempFiles = true
+
+		lines := make([]string, 0, 2000)
+		for i := 0; i < 2000; i++ {
+			lines = append(lines, fmt.Sprintf("%05v", 2000-i))
+		}
+		tests.CheckNotError(t, tools.CreateFile(cfg.InputFilePath, "n\n"+strings.Join(lines, "\n")))
+
+		out := &strings.Builder{}
+		ctx := WithStdio(tools.Ctx, Stdio{Out: out})
+		tests.CheckNotError(t, ExecExtSort(ctx, cfg))
+
+		sort.Strings(lines)
+		expected := "n\n" + strings.Join(lines, "\n")
+		if outputFilePath == StdioFilePath {
+			tests.CheckExpected(t, expected, out.String())
+		} else {
+			tests.CheckExpected(t, expected, tools.ReadFile(t, cfg.OutputFilePath))
+		}
+
+		tools.CheckReleased(t)
+		tests.CheckNotError(t, tools.CheckAbsent(cfg.TempDir+"/left_000001"))
+	}
+}
@@ -117,3 +117,19 @@ func (this *TestTools) Sleep(ctx context.Context, dur time.Duration) error {
 		return nil
 	}
 }
+
+// ReadFile returns the content of the file, the test fails if the file can not be read.
+func (this *TestTools) ReadFile(t *testing.T, name string) string {
+	file, _, err := this.Fs.OpenReadFile(name)
+	tests.CheckNotError(t, err)
+	data, err := io.ReadAll(file)
+	tests.CheckNotError(t, err)
+	tests.CheckNotError(t, file.Close())
+	return string(data)
+}
+
+// CheckReleased fails the test if some errors are unhandled or files are left opened.
+func (this *TestTools) CheckReleased(t *testing.T) {
+	tests.CheckExpected(t, 0, len(this.UnhandledErrs()))
+	tests.CheckExpected(t, false, this.Fs.HasOpenedEntries())
+}
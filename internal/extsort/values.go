@@ -0,0 +1,431 @@
+package extsort
+
+import (
+	"bufio"
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+
+	"github.com/kdpdev/extsort/internal/utils/misc"
+)
+
+type ValuesGen[T any] func() (value T, done bool, err error)
+
+func NewSliceValuesGen[T any](values []T) ValuesGen[T] {
+	return func() (T, bool, error) {
+		var value T
+		if len(values) == 0 {
+			return value, true, nil
+		}
+		value, values = values[0], values[1:]
+		return value, false, nil
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// SortValuesOptions configures SortValues. Temp files are created by the context Fs in TempDir,
+// the directory must exist and must not be used by other sorts at the same time.
+type SortValuesOptions struct {
+	TempDir            string
+	WorkersCount       int
+	PreferredChunkSize int
+	ReadBufSize        int
+	WriteBufSize       int
+	MaxOpenFiles       int // chunks merged by the iterator at once, zero means DefaultMaxOpenFiles
+}
+
+func NewDefaultSortValuesOptions() SortValuesOptions {
+	return SortValuesOptions{
+		TempDir:            GetDefaultTempDir(),
+		WorkersCount:       GetDefaultWorkersCount(),
+		PreferredChunkSize: DefaultPreferredChunkSizeKb * 1024,
+		ReadBufSize:        DefaultWorkerReadBufSizeKb * 1024,
+		WriteBufSize:       DefaultWorkerWriteBufSizeKb * 1024,
+		MaxOpenFiles:       DefaultMaxOpenFiles,
+	}
+}
+
+func (this SortValuesOptions) Check() error {
+	if this.TempDir == "" {
+		return fmt.Errorf("%w: TempDir is not specified", ErrBadConfig)
+	}
+
+	if this.WorkersCount <= 0 {
+		return fmt.Errorf("%w: WorkersCount is negative or zero", ErrBadConfig)
+	}
+
+	if this.PreferredChunkSize < 0 || this.ReadBufSize < 0 || this.WriteBufSize < 0 {
+		return fmt.Errorf("%w: chunk or buffer size is negative", ErrBadConfig)
+	}
+
+	if this.MaxOpenFiles < 0 || this.MaxOpenFiles == 1 {
+		return fmt.Errorf("%w: MaxOpenFiles must be zero or at least 2", ErrBadConfig)
+	}
+
+	return nil
+}
+
+// SortValues sorts values by spilling encoded chunks to temp files. The sort is stable.
+// The returned iterator merges the chunks, every record is decoded once. The iterator must be closed.
+func SortValues[T any](
+	ctx context.Context,
+	source ValuesGen[T],
+	codec Codec[T],
+	less func(lhs, rhs T) bool,
+	opts SortValuesOptions) (*ValuesIterator[T], error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := opts.Check(); err != nil {
+		return nil, err
+	}
+
+	if opts.MaxOpenFiles == 0 {
+		opts.MaxOpenFiles = DefaultMaxOpenFiles
+	}
+
+	ctx = WithCallerScope(ctx)
+
+	chunkFiles, err := splitValues(ctx, source, codec, less, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return newValuesIterator(ctx, chunkFiles, codec, less, opts)
+}
+
+type encodedValue[T any] struct {
+	value  T
+	record string
+}
+
+func splitValues[T any](
+	ctx context.Context,
+	source ValuesGen[T],
+	codec Codec[T],
+	less func(lhs, rhs T) bool,
+	opts SortValuesOptions) ([]string, error) {
+
+	framing := codec.Framing()
+	saveChunk := makeChunksSaver(opts.TempDir, "", opts.WriteBufSize, false)
+	spiller := newChunksSpiller(ctx, opts.WorkersCount)
+
+	items := make([]encodedValue[T], 0)
+	itemsSize := 0
+
+	spill := func() error {
+		chunkItems := items
+		items, itemsSize = make([]encodedValue[T], 0, len(chunkItems)), 0
+		return spiller.spill(func(ctx context.Context) (string, error) {
+			sort.SliceStable(chunkItems, func(i, j int) bool {
+				return less(chunkItems[i].value, chunkItems[j].value)
+			})
+
+			chunk := NewArrStringsChunkWithFraming(len(chunkItems), framing)
+			for _, item := range chunkItems {
+				chunk.Add(item.record)
+			}
+			return saveChunk(ctx, chunk)
+		})
+	}
+
+	enumErr := func() error {
+		for {
+			if e := spiller.ctx.Err(); e != nil {
+				return e
+			}
+
+			value, done, e := source()
+			if e != nil {
+				return e
+			}
+			if done {
+				break
+			}
+
+			record, e := codec.Encode(value)
+			if e != nil {
+				return e
+			}
+
+			items = append(items, encodedValue[T]{value, record})
+			itemsSize += framing.SerializedSize(record)
+			if itemsSize >= opts.PreferredChunkSize {
+				if e = spill(); e != nil {
+					return e
+				}
+			}
+		}
+
+		if len(items) > 0 || spiller.seq == 0 { // at least 1 chunk is produced (even if it is empty)
+			return spill()
+		}
+		return nil
+	}()
+
+	spiller.fail(enumErr)
+	return spiller.close()
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// ValuesIterator merges sorted chunks of values: for it.Next() { use(it.Value()) }, then check it.Err().
+// The chunks are removed by Close.
+type ValuesIterator[T any] struct {
+	ctx       context.Context
+	codec     Codec[T]
+	filePaths []string
+	files     []io.Closer
+	sources   valuesHeap[T]
+	current   encodedValue[T]
+	err       error
+}
+
+func newValuesIterator[T any](
+	ctx context.Context,
+	filePaths []string,
+	codec Codec[T],
+	less func(lhs, rhs T) bool,
+	opts SortValuesOptions) (_ *ValuesIterator[T], err error) {
+
+	this := &ValuesIterator[T]{
+		ctx:       ctx,
+		codec:     codec,
+		filePaths: filePaths,
+		sources:   valuesHeap[T]{less: less},
+	}
+	defer misc.InvokeIfError(&err, func() {
+		if e := this.Close(); e != nil {
+			OnUnhandledError(ctx, e)
+		}
+	})
+
+	if opts.MaxOpenFiles > 0 {
+		this.filePaths, err = reduceValuesFiles(ctx, this.filePaths, codec, less, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	framing := codec.Framing()
+	fs := GetFs(ctx)
+	for idx, filePath := range this.filePaths {
+		file, _, e := fs.OpenReadFile(filePath)
+		if e != nil {
+			return nil, e
+		}
+		this.files = append(this.files, file)
+
+		source := &valuesSource[T]{
+			reader: framing.NewReader(bufio.NewReaderSize(file, opts.ReadBufSize)),
+			idx:    idx,
+		}
+		hasValue, e := source.next(codec)
+		if e != nil {
+			return nil, e
+		}
+		if hasValue {
+			this.sources.items = append(this.sources.items, source)
+		}
+	}
+	heap.Init(&this.sources)
+
+	return this, nil
+}
+
+func (this *ValuesIterator[T]) Next() bool {
+	if this.err != nil || len(this.sources.items) == 0 {
+		return false
+	}
+
+	if this.err = this.ctx.Err(); this.err != nil {
+		return false
+	}
+
+	top := this.sources.items[0]
+	this.current = top.current
+
+	hasValue, err := top.next(this.codec)
+	if err != nil {
+		this.err = err
+		return false
+	}
+	if hasValue {
+		heap.Fix(&this.sources, 0)
+	} else {
+		heap.Pop(&this.sources)
+	}
+
+	return true
+}
+
+func (this *ValuesIterator[T]) Value() T {
+	return this.current.value
+}
+
+func (this *ValuesIterator[T]) Err() error {
+	return this.err
+}
+
+// Close closes and removes the chunk files.
+func (this *ValuesIterator[T]) Close() (err error) {
+	// the chunks are removed even if the iteration is cancelled
+	ctx := context.WithoutCancel(this.ctx)
+
+	onceErr := misc.NewOnceError(&err)
+	onceErr = misc.NewOnceEventWithNotSetNotification(onceErr, GetContextedUnhandledErrorHandler(ctx))
+
+	for _, file := range this.files {
+		onceErr.Invoke(file.Close)
+	}
+	this.files = nil
+	this.sources.items = nil
+
+	fs := GetFs(ctx)
+	for _, filePath := range this.filePaths {
+		onceErr.Invoke(func() error { return fs.Remove(filePath) })
+	}
+	this.filePaths = nil
+
+	return err
+}
+
+// reduceValuesFiles merges groups of adjacent files until there are no more than MaxOpenFiles of them,
+// the merging of adjacent files keeps the stability.
+func reduceValuesFiles[T any](
+	ctx context.Context,
+	filePaths []string,
+	codec Codec[T],
+	less func(lhs, rhs T) bool,
+	opts SortValuesOptions) ([]string, error) {
+
+	getMergedFilePath := misc.MakeSequencedStringsGen(filepath.Join(opts.TempDir, "reduced_%06v"))
+	for len(filePaths) > opts.MaxOpenFiles {
+		reduced := make([]string, 0, (len(filePaths)+opts.MaxOpenFiles-1)/opts.MaxOpenFiles)
+		for i := 0; i < len(filePaths); i += opts.MaxOpenFiles {
+			group := filePaths[i:min(i+opts.MaxOpenFiles, len(filePaths))]
+			if len(group) == 1 {
+				reduced = append(reduced, group[0])
+				continue
+			}
+
+			mergedFilePath := getMergedFilePath()
+			if err := mergeValuesFiles(ctx, group, mergedFilePath, codec, less, opts); err != nil {
+				return append(reduced, filePaths[i+len(group):]...), err
+			}
+			reduced = append(reduced, mergedFilePath)
+		}
+		filePaths = reduced
+	}
+	return filePaths, nil
+}
+
+// mergeValuesFiles merges the files to the output file, the merged files are removed in any case.
+func mergeValuesFiles[T any](
+	ctx context.Context,
+	filePaths []string,
+	outputFilePath string,
+	codec Codec[T],
+	less func(lhs, rhs T) bool,
+	opts SortValuesOptions) (err error) {
+
+	onceErr := misc.NewOnceError(&err)
+	onceErr = misc.NewOnceEventWithNotSetNotification(onceErr, GetContextedUnhandledErrorHandler(ctx))
+
+	opts.MaxOpenFiles = 0
+	it, err := newValuesIterator(ctx, filePaths, codec, less, opts)
+	if err != nil {
+		return err
+	}
+	defer onceErr.Invoke(it.Close)
+
+	fs := GetFs(ctx)
+	output, err := fs.CreateWriteFile(outputFilePath)
+	if err != nil {
+		return err
+	}
+	defer misc.InvokeIfError(&err, func() {
+		if e := fs.Remove(outputFilePath); e != nil {
+			OnUnhandledError(ctx, e)
+		}
+	})
+	defer onceErr.Invoke(output.Close)
+
+	writer := bufio.NewWriterSize(output, opts.WriteBufSize)
+	recordWriter := codec.Framing().NewWriter(writer)
+	for it.Next() {
+		if _, err = recordWriter.WriteRecord(it.current.record); err != nil {
+			return err
+		}
+	}
+	if err = it.Err(); err != nil {
+		return err
+	}
+
+	return writer.Flush()
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+type valuesSource[T any] struct {
+	reader  RecordReader
+	current encodedValue[T]
+	idx     int
+}
+
+func (this *valuesSource[T]) next(codec Codec[T]) (bool, error) {
+	record, err := this.reader.ReadRecord()
+	if errors.Is(err, io.EOF) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	value, err := codec.Decode(record)
+	if err != nil {
+		return false, err
+	}
+
+	this.current = encodedValue[T]{value, record}
+	return true, nil
+}
+
+// valuesHeap takes values of earlier sources first on ties.
+type valuesHeap[T any] struct {
+	items []*valuesSource[T]
+	less  func(lhs, rhs T) bool
+}
+
+func (this *valuesHeap[T]) Len() int {
+	return len(this.items)
+}
+
+func (this *valuesHeap[T]) Less(i, j int) bool {
+	lhs, rhs := this.items[i], this.items[j]
+	if this.less(lhs.current.value, rhs.current.value) {
+		return true
+	}
+	return !this.less(rhs.current.value, lhs.current.value) && lhs.idx < rhs.idx
+}
+
+func (this *valuesHeap[T]) Swap(i, j int) {
+	this.items[i], this.items[j] = this.items[j], this.items[i]
+}
+
+func (this *valuesHeap[T]) Push(x any) {
+	this.items = append(this.items, x.(*valuesSource[T]))
+}
+
+func (this *valuesHeap[T]) Pop() any {
+	last := this.items[len(this.items)-1]
+	this.items = this.items[:len(this.items)-1]
+	return last
+}
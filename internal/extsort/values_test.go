@@ -0,0 +1,143 @@
+package extsort
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/kdpdev/extsort/internal/utils/tests"
+)
+
+type testValue struct {
+	Name  string
+	Score int
+	Tags  []string
+}
+
+func newTestValuesOptions(t *testing.T) (*TestTools, SortValuesOptions) {
+	tools := NewTestTools(t)
+	opts := NewDefaultSortValuesOptions()
+	opts.TempDir = tools.SplittingOpts.OutputDir
+	opts.WorkersCount = 2
+	opts.PreferredChunkSize = 1024
+	return tools, opts
+}
+
+func collectValues[T any](t *testing.T, tools *TestTools, it *ValuesIterator[T]) []T {
+	values := make([]T, 0)
+	for it.Next() {
+		values = append(values, it.Value())
+	}
+	tests.CheckNotError(t, it.Err())
+	filePaths := it.filePaths
+	tests.CheckNotError(t, it.Close())
+	for _, filePath := range filePaths {
+		tests.CheckNotError(t, tools.CheckAbsent(filePath))
+	}
+	return values
+}
+
+func Test_SortValues_Gob(t *testing.T) {
+	for _, maxOpenFiles := range []int{0, 3} {
+		tools, opts := newTestValuesOptions(t)
+		opts.MaxOpenFiles = maxOpenFiles
+
+		values := make([]testValue, 0, 1000)
+		for i := 0; i < 1000; i++ {
+			values = append(values, testValue{Name: fmt.Sprintf("v%04d", i), Score: rand.Intn(50), Tags: []string{"x"}})
+		}
+
+		less := func(lhs, rhs testValue) bool { return lhs.Score < rhs.Score }
+		it, err := SortValues(tools.Ctx, NewSliceValuesGen(values), NewGobCodec[testValue](), less, opts)
+		tests.CheckNotError(t, err)
+		if maxOpenFiles > 0 {
+			tests.CheckExpected(t, true, len(it.filePaths) <= maxOpenFiles)
+		}
+		sorted := collectValues(t, tools, it)
+
+		sort.SliceStable(values, func(i, j int) bool { return less(values[i], values[j]) })
+		tests.CheckExpected(t, len(values), len(sorted))
+		for i := range values {
+			tests.CheckExpectedf(t, values[i].Name, sorted[i].Name, "value #%v", i)
+			tests.CheckExpectedf(t, values[i].Score, sorted[i].Score, "value #%v", i)
+		}
+
+		tools.CheckReleased(t)
+	}
+}
+
+func Test_SortValues_Binary(t *testing.T) {
+	tools, opts := newTestValuesOptions(t)
+
+	type point struct {
+		X int64
+		Y float64
+	}
+
+	codec, err := NewBinaryCodec[point](binary.LittleEndian)
+	tests.CheckNotError(t, err)
+	tests.CheckExpected(t, 16, codec.Framing().SerializedSize(string(make([]byte, 16))))
+
+	values := make([]point, 0, 500)
+	for i := 0; i < 500; i++ {
+		values = append(values, point{X: int64(rand.Intn(1000) - 500), Y: float64(i)})
+	}
+
+	less := func(lhs, rhs point) bool { return lhs.X < rhs.X }
+	it, err := SortValues(tools.Ctx, NewSliceValuesGen(values), codec, less, opts)
+	tests.CheckNotError(t, err)
+	sorted := collectValues(t, tools, it)
+
+	sort.SliceStable(values, func(i, j int) bool { return less(values[i], values[j]) })
+	tests.CheckExpected(t, fmt.Sprint(values), fmt.Sprint(sorted))
+
+	it, err = SortValues(tools.Ctx, NewSliceValuesGen[point](nil), codec, less, opts)
+	tests.CheckNotError(t, err)
+	tests.CheckExpected(t, 0, len(collectValues(t, tools, it)))
+
+	_, err = NewBinaryCodec[testValue](binary.LittleEndian)
+	tests.CheckErrorIs(t, ErrBadConfig, err)
+
+	opts.TempDir = ""
+	_, err = SortValues(tools.Ctx, NewSliceValuesGen(values), codec, less, opts)
+	tests.CheckErrorIs(t, ErrBadConfig, err)
+
+	tools.CheckReleased(t)
+}
+
+func Test_SortValues_Cancel(t *testing.T) {
+	tools, opts := newTestValuesOptions(t)
+
+	values := make([]int, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		values = append(values, rand.Intn(1000))
+	}
+
+	ctx, cancel := context.WithCancel(tools.Ctx)
+	defer cancel()
+
+	less := func(lhs, rhs int) bool { return lhs < rhs }
+	it, err := SortValues(ctx, NewSliceValuesGen(values), NewGobCodec[int](), less, opts)
+	tests.CheckNotError(t, err)
+
+	count := 0
+	for it.Next() {
+		count++
+		if count == 10 {
+			cancel()
+		}
+	}
+	tests.CheckExpected(t, 10, count)
+	tests.CheckErrorIs(t, context.Canceled, it.Err())
+
+	filePaths := it.filePaths
+	tests.CheckNotError(t, it.Close())
+	for _, filePath := range filePaths {
+		tests.CheckNotError(t, tools.CheckAbsent(filePath))
+	}
+
+	tools.CheckReleased(t)
+}
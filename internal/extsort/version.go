@@ -0,0 +1,50 @@
+package extsort
+
+import (
+	"strings"
+)
+
+// VersionCompare compares strings in the natural order: runs of digits are compared
+// as numbers and everything else as text, so "file2" goes before "file10".
+func VersionCompare(lhs, rhs string) int {
+	i, j := 0, 0
+	for i < len(lhs) && j < len(rhs) {
+		if isDigit(lhs[i]) && isDigit(rhs[j]) {
+			lhsEnd := skipDigits(lhs, i)
+			rhsEnd := skipDigits(rhs, j)
+
+			lhsNum := strings.TrimLeft(lhs[i:lhsEnd], "0")
+			rhsNum := strings.TrimLeft(rhs[j:rhsEnd], "0")
+
+			result := len(lhsNum) - len(rhsNum)
+			if result == 0 {
+				result = strings.Compare(lhsNum, rhsNum)
+			}
+			if result != 0 {
+				return sign(result)
+			}
+
+			i, j = lhsEnd, rhsEnd
+			continue
+		}
+
+		if lhs[i] != rhs[j] {
+			if lhs[i] < rhs[j] {
+				return -1
+			}
+			return 1
+		}
+
+		i++
+		j++
+	}
+
+	return sign((len(lhs) - i) - (len(rhs) - j))
+}
+
+func skipDigits(str string, i int) int {
+	for i < len(str) && isDigit(str[i]) {
+		i++
+	}
+	return i
+}
@@ -0,0 +1,29 @@
+package extsort
+
+import (
+	"testing"
+)
+
+func Test_VersionCompare(t *testing.T) {
+	checkCompareOrder(t, VersionCompare,
+		[]string{""},
+		[]string{"1", "01", "001"},
+		[]string{"1.2"},
+		[]string{"1.2.9"},
+		[]string{"1.2.10", "1.02.010"},
+		[]string{"1.10"},
+		[]string{"2"},
+		[]string{"10"},
+		[]string{"file"},
+		[]string{"file2"},
+		[]string{"file10"},
+		[]string{"file10a"},
+		[]string{"file10b"},
+		[]string{"fileA"},
+		[]string{"v1.0.0"},
+		[]string{"v1.0.0-rc1"},
+		[]string{"v1.0.0-rc2"},
+		[]string{"v1.0.0-rc10"},
+		[]string{"v1.0.1"},
+	)
+}